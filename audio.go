@@ -0,0 +1,430 @@
+package whisper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// tempDirPrefix identifies the conversion temp dirs created by this package
+const tempDirPrefix = "gowhisper-convert-"
+
+// staleTempDirAge is the age after which leftover conversion temp dirs are removed
+const staleTempDirAge = time.Hour
+
+// init removes conversion temp dirs leaked by killed processes.
+// Set GOWHISPER_NO_TEMP_CLEANUP=1 to disable it.
+func init() {
+	if os.Getenv("GOWHISPER_NO_TEMP_CLEANUP") == "1" {
+		return
+	}
+	go CleanupStaleTempDirs(staleTempDirAge)
+}
+
+// CleanupStaleTempDirs removes conversion temp dirs created by this package that
+// are older than maxAge. Transcribe removes its temp dir when it returns, but the
+// dir leaks if the process is killed mid-run. Only dirs with the package's prefix
+// in the system temp directory are touched.
+func CleanupStaleTempDirs(maxAge time.Duration) error {
+	tmp := os.TempDir()
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(tmp, entry.Name())); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// IntermediateFormat is the format of the temporary file audio is converted to
+type IntermediateFormat string
+
+const (
+	// IntermediateWAV converts to 16-bit PCM WAV (default)
+	IntermediateWAV IntermediateFormat = "wav"
+	// IntermediateFLAC converts to lossless FLAC to save temp disk space
+	IntermediateFLAC IntermediateFormat = "flac"
+)
+
+// ext returns the file extension of the format
+func (f IntermediateFormat) ext() string {
+	if f == IntermediateFLAC {
+		return ".flac"
+	}
+	return ".wav"
+}
+
+// AudioDecoder decodes audio files to mono float32 samples in [-1, 1].
+// Set it in TranscriptionOptions.Decoder to replace the ffmpeg conversion, for
+// example with a pure-Go decoder. Samples at other rates are resampled to 16kHz.
+type AudioDecoder interface {
+	Decode(path string) (samples []float32, sampleRate int, err error)
+}
+
+// conversion holds the settings for converting input audio with ffmpeg
+type conversion struct {
+	ffmpegArgs []string
+	format     IntermediateFormat
+	// decoder replaces ffmpeg when set
+	decoder AudioDecoder
+	// cacheDir keeps converted files for reuse when set
+	cacheDir string
+}
+
+// readCachedConversion reads the audio file through the conversion cache,
+// converting it only if the cache has no entry for its content and settings
+func readCachedConversion(audioFile string, conv conversion) ([]float32, error) {
+	key, err := conversionKey(audioFile, conv)
+	if err != nil {
+		return nil, err
+	}
+	cached := filepath.Join(conv.cacheDir, key+conv.format.ext())
+	if _, err := os.Stat(cached); err == nil {
+		return decodeIntermediate(cached, conv.format)
+	}
+
+	if err := os.MkdirAll(conv.cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create conversion cache directory: %w", err)
+	}
+	// Convert next to the entry and rename, so that an interrupted run never
+	// leaves a partial file under the final name
+	tmp, err := os.CreateTemp(conv.cacheDir, key+"-*"+conv.format.ext())
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := convertIntermediate(audioFile, tmp.Name(), conv); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return nil, err
+	}
+	return decodeIntermediate(cached, conv.format)
+}
+
+// conversionKey returns the cache key of the audio file: a hash of its content,
+// the intermediate format and the extra ffmpeg arguments
+func conversionKey(audioFile string, conv conversion) (string, error) {
+	f, err := os.Open(audioFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "\x00%s", conv.format.ext())
+	for _, arg := range conv.ffmpegArgs {
+		fmt.Fprintf(h, "\x00%s", arg)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// decodeCustom reads the audio file with a user supplied decoder
+func decodeCustom(decoder AudioDecoder, audioFile string) ([]float32, error) {
+	samples, sampleRate, err := decoder.Decode(audioFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", audioFile, err)
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("decoder returned invalid sample rate %d for %s", sampleRate, audioFile)
+	}
+	return resample(samples, sampleRate, SampleRate), nil
+}
+
+// decodePCM decodes any audio file ffmpeg understands into 16kHz mono samples
+// by reading raw signed 16-bit PCM from its stdout
+func decodePCM(path string) ([]float32, error) {
+	cmd := exec.Command("ffmpeg", "-i", path, "-f", "s16le", "-ar", strconv.Itoa(SampleRate), "-ac", "1", "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %s: %s", err, stderr.String())
+	}
+	return pcm16ToFloat32(stdout.Bytes()), nil
+}
+
+// pcm16ToFloat32 converts little-endian signed 16-bit PCM to float32 samples in [-1, 1)
+func pcm16ToFloat32(pcm []byte) []float32 {
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768
+	}
+	return samples
+}
+
+// TranscribeBuffer transcribes a pre-decoded go-audio buffer such as the
+// *audio.IntBuffer returned by wav.Decoder.FullPCMBuffer. Multi-channel audio
+// is downmixed to mono and resampled to 16kHz if needed.
+func (w *Whisper) TranscribeBuffer(buf audio.Buffer, opts TranscriptionOptions) (TranscriptionResult, error) {
+	samples, err := bufferSamples(buf)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	return w.transcribe(samples, opts, nil)
+}
+
+// bufferSamples converts a go-audio buffer to 16kHz mono float32 samples
+func bufferSamples(buf audio.Buffer) ([]float32, error) {
+	format := buf.PCMFormat()
+	if format == nil || format.SampleRate <= 0 || format.NumChannels <= 0 {
+		return nil, fmt.Errorf("audio buffer has no valid format")
+	}
+
+	samples := downmix(buf.AsFloat32Buffer().Data, format.NumChannels)
+	return resample(samples, format.SampleRate, SampleRate), nil
+}
+
+// downmix averages interleaved channels into a single channel
+func downmix(data []float32, channels int) []float32 {
+	if channels == 1 {
+		return data
+	}
+	mono := make([]float32, len(data)/channels)
+	for i := range mono {
+		var sum float32
+		for c := range channels {
+			sum += data[i*channels+c]
+		}
+		mono[i] = sum / float32(channels)
+	}
+	return mono
+}
+
+// resample converts samples from one sample rate to another using linear interpolation
+func resample(data []float32, from, to int) []float32 {
+	if from == to || len(data) == 0 {
+		return data
+	}
+	out := make([]float32, int(int64(len(data))*int64(to)/int64(from)))
+	ratio := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * ratio
+		j := int(pos)
+		if j+1 >= len(data) {
+			out[i] = data[len(data)-1]
+			continue
+		}
+		frac := float32(pos - float64(j))
+		out[i] = data[j]*(1-frac) + data[j+1]*frac
+	}
+	return out
+}
+
+const (
+	// clipLevel is the magnitude from which a sample is considered saturated
+	clipLevel = 0.999
+	// clipWarnFraction is the fraction of saturated samples from which a warning is logged
+	clipWarnFraction = 0.001
+)
+
+// removeDCOffset returns a copy of the samples with their mean subtracted
+func removeDCOffset(data []float32) []float32 {
+	if len(data) == 0 {
+		return data
+	}
+	var sum float64
+	for _, v := range data {
+		sum += float64(v)
+	}
+	mean := float32(sum / float64(len(data)))
+
+	out := make([]float32, len(data))
+	for i, v := range data {
+		out[i] = v - mean
+	}
+	return out
+}
+
+// clippedFraction returns the fraction of samples saturated at or near full scale
+func clippedFraction(data []float32) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	clipped := 0
+	for _, v := range data {
+		if abs32(v) >= clipLevel {
+			clipped++
+		}
+	}
+	return float64(clipped) / float64(len(data))
+}
+
+const (
+	// normalizeTargetRMS is the level NormalizeGain brings quiet audio up to (-20 dBFS)
+	normalizeTargetRMS = 0.1
+	// normalizeMaxPeak caps the gain so that no sample clips
+	normalizeMaxPeak = 0.99
+)
+
+// normalizeGain returns a copy of the samples amplified to normalizeTargetRMS,
+// with the gain limited so the peak stays below normalizeMaxPeak.
+// Audio that is already loud enough, or silent, is returned unchanged.
+func normalizeGain(data []float32) []float32 {
+	var sumSquares float64
+	var peak float32
+	for _, v := range data {
+		sumSquares += float64(v) * float64(v)
+		peak = max(peak, abs32(v))
+	}
+	if peak == 0 {
+		return data
+	}
+
+	rms := math.Sqrt(sumSquares / float64(len(data)))
+	gain := min(normalizeTargetRMS/rms, normalizeMaxPeak/float64(peak))
+	if gain <= 1 {
+		return data
+	}
+
+	out := make([]float32, len(data))
+	for i, v := range data {
+		out[i] = v * float32(gain)
+	}
+	return out
+}
+
+// rmsDBFS returns the RMS level of the samples in dB relative to full scale,
+// or -Inf for silence
+func rmsDBFS(data []float32) float64 {
+	var sumSquares float64
+	for _, v := range data {
+		sumSquares += float64(v) * float64(v)
+	}
+	if sumSquares == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(math.Sqrt(sumSquares/float64(len(data))))
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// AudioInfo describes the audio stream of a file
+type AudioInfo struct {
+	SampleRate int
+	Channels   int
+	Duration   time.Duration
+	Codec      string // ffmpeg codec name, e.g. pcm_s16le, mp3 or opus
+}
+
+// Probe returns the properties of the audio file. Plain PCM WAV files are read
+// in pure Go, other files with ffprobe, which is installed alongside ffmpeg.
+func Probe(audioFile string) (AudioInfo, error) {
+	if info, ok := probeWAV(audioFile); ok {
+		return info, nil
+	}
+	return probeFFprobe(audioFile)
+}
+
+// probeWAV reads the header of a PCM WAV file, reporting false for anything else
+func probeWAV(path string) (AudioInfo, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AudioInfo{}, false
+	}
+	defer f.Close()
+
+	d := wav.NewDecoder(f)
+	if !d.IsValidFile() || d.WavAudioFormat != wavFormatPCM {
+		return AudioInfo{}, false
+	}
+	// Decoder.Duration estimates from the RIFF size, the data chunk is exact
+	if err := d.FwdToPCM(); err != nil {
+		return AudioInfo{}, false
+	}
+	frameSize := int64(d.NumChans) * int64(d.BitDepth) / 8
+	if d.SampleRate == 0 || frameSize == 0 {
+		return AudioInfo{}, false
+	}
+	frames := d.PCMLen() / frameSize
+	return AudioInfo{
+		SampleRate: int(d.SampleRate),
+		Channels:   int(d.NumChans),
+		Duration:   time.Duration(frames) * time.Second / time.Duration(d.SampleRate),
+		Codec:      pcmCodec(int(d.BitDepth)),
+	}, true
+}
+
+// pcmCodec returns the ffmpeg name of the little-endian PCM codec of a bit depth
+func pcmCodec(bitDepth int) string {
+	if bitDepth == 8 {
+		return "pcm_u8"
+	}
+	return "pcm_s" + strconv.Itoa(bitDepth) + "le"
+}
+
+// ffprobeOutput is the subset of ffprobe's JSON output used by probeFFprobe
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecName  string `json:"codec_name"`
+		SampleRate string `json:"sample_rate"`
+		Channels   int    `json:"channels"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeFFprobe reads the properties of the first audio stream with ffprobe
+func probeFFprobe(path string) (AudioInfo, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels:format=duration", "-of", "json", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return AudioInfo{}, fmt.Errorf("ffprobe failed: %s: %s", err, stderr.String())
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return AudioInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return AudioInfo{}, fmt.Errorf("%s has no audio stream", path)
+	}
+
+	stream := probe.Streams[0]
+	info := AudioInfo{Channels: stream.Channels, Codec: stream.CodecName}
+	info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+	if sec, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(sec * float64(time.Second))
+	}
+	return info, nil
+}
@@ -0,0 +1,189 @@
+package whisper
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+func TestBufferSamples(t *testing.T) {
+	// 32kHz stereo, 16-bit
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: 2, SampleRate: 32000},
+		Data:           []int{16384, 0, 16384, 0, -16384, 0, -16384, 0},
+		SourceBitDepth: 16,
+	}
+
+	samples, err := bufferSamples(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples after downmix and resampling, got %d", len(samples))
+	}
+	if samples[0] != 0.25 || samples[1] != -0.25 {
+		t.Errorf("Unexpected samples %v", samples)
+	}
+}
+
+func TestNormalizeGain(t *testing.T) {
+	quiet := []float32{0.01, -0.01, 0.01, -0.01}
+	out := normalizeGain(quiet)
+	if out[0] < 0.09 || out[0] > 0.11 {
+		t.Errorf("Expected quiet audio to be amplified to about 0.1, got %v", out[0])
+	}
+	if quiet[0] != 0.01 {
+		t.Error("Expected input samples to be left untouched")
+	}
+
+	// A single loud peak limits the gain
+	peaky := []float32{0.5, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	out = normalizeGain(peaky)
+	if out[0] > normalizeMaxPeak+1e-6 {
+		t.Errorf("Expected peak to be limited to %v, got %v", normalizeMaxPeak, out[0])
+	}
+
+	loud := []float32{0.8, -0.8}
+	if out := normalizeGain(loud); out[0] != 0.8 {
+		t.Errorf("Expected loud audio to be unchanged, got %v", out[0])
+	}
+	if out := normalizeGain([]float32{0, 0}); out[0] != 0 {
+		t.Errorf("Expected silence to be unchanged, got %v", out)
+	}
+}
+
+type stubDecoder struct {
+	samples    []float32
+	sampleRate int
+}
+
+func (d stubDecoder) Decode(path string) ([]float32, int, error) {
+	return d.samples, d.sampleRate, nil
+}
+
+func TestCustomDecoder(t *testing.T) {
+	conv := TranscriptionOptions{Decoder: stubDecoder{[]float32{0.5, 0.5, -0.5, -0.5}, 32000}}.conversion()
+	samples, err := readAudioFile("does-not-need-ffmpeg.mp3", conv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[0] != 0.5 || samples[1] != -0.5 {
+		t.Errorf("Expected decoded samples resampled to 16kHz, got %v", samples)
+	}
+
+	if _, err := decodeCustom(stubDecoder{nil, 0}, "bad.mp3"); err == nil {
+		t.Error("Expected error for invalid sample rate")
+	}
+}
+
+func writeTestWAV(t *testing.T, sampleRate, channels, frames int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := wav.NewEncoder(f, sampleRate, 16, channels, wavFormatPCM)
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: channels, SampleRate: sampleRate},
+		Data:           make([]int, channels*frames),
+		SourceBitDepth: 16,
+	}
+	if err := enc.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbeWAV(t *testing.T) {
+	path := writeTestWAV(t, 44100, 2, 44100/2)
+
+	info, err := Probe(path)
+	if err != nil {
+		t.Fatalf("Failed to probe: %v", err)
+	}
+	want := AudioInfo{SampleRate: 44100, Channels: 2, Duration: 500 * time.Millisecond, Codec: "pcm_s16le"}
+	if info != want {
+		t.Errorf("Probe() = %+v, want %+v", info, want)
+	}
+}
+
+func TestTranscribePreparedWAVFormat(t *testing.T) {
+	w := &Whisper{state: &nativeState{}}
+	if _, err := w.TranscribePreparedWAV(writeTestWAV(t, 44100, 2, 100), TranscriptionOptions{}); err == nil {
+		t.Error("Expected 44.1kHz stereo WAV to be rejected")
+	}
+	if _, err := w.TranscribePreparedWAV(writeTestWAV(t, SampleRate, 1, 100), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected 16kHz mono WAV to be accepted, got %v", err)
+	}
+}
+
+func TestRemoveDCOffset(t *testing.T) {
+	in := []float32{0.6, 0.4, 0.6, 0.4}
+	out := removeDCOffset(in)
+	for i, want := range []float32{0.1, -0.1, 0.1, -0.1} {
+		if d := out[i] - want; d > 1e-6 || d < -1e-6 {
+			t.Errorf("Sample %d = %v, want %v", i, out[i], want)
+		}
+	}
+	if in[0] != 0.6 {
+		t.Error("Expected input samples to be left untouched")
+	}
+
+	if f := clippedFraction([]float32{1, -1, 0.5, 0}); f != 0.5 {
+		t.Errorf("Expected half the samples to be clipped, got %v", f)
+	}
+}
+
+func TestConversionCache(t *testing.T) {
+	input := writeTestWAV(t, SampleRate, 1, 160)
+	conv := TranscriptionOptions{ConversionCacheDir: t.TempDir()}.conversion()
+
+	key, err := conversionKey(input, conv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again, _ := conversionKey(input, conv); again != key {
+		t.Error("Expected the cache key to be deterministic")
+	}
+	withArgs := conv
+	withArgs.ffmpegArgs = []string{"-af", "highpass=f=200"}
+	if other, _ := conversionKey(input, withArgs); other == key {
+		t.Error("Expected ffmpeg arguments to change the cache key")
+	}
+
+	// A cached entry is decoded without running ffmpeg
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(conv.cacheDir, key+".wav"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := readAudioFile(input, conv)
+	if err != nil {
+		t.Fatalf("Failed to read cached conversion: %v", err)
+	}
+	if len(samples) != 160 {
+		t.Errorf("Expected 160 samples, got %d", len(samples))
+	}
+}
+
+func TestRMSDBFS(t *testing.T) {
+	if db := rmsDBFS([]float32{0.1, -0.1, 0.1, -0.1}); db < -20.01 || db > -19.99 {
+		t.Errorf("Expected -20 dBFS, got %v", db)
+	}
+	if db := rmsDBFS([]float32{0, 0}); !math.IsInf(db, -1) {
+		t.Errorf("Expected -Inf for silence, got %v", db)
+	}
+}
@@ -0,0 +1,57 @@
+package whisper
+
+import (
+	"sync"
+
+	"github.com/ebitengine/purego"
+)
+
+// segmentHandler collects the native segments [first, first+n) of a running
+// transcription and returns false to abort it
+type segmentHandler func(first, n int) bool
+
+var (
+	segmentCallbackOnce sync.Once
+	segmentCallbackPtr  uintptr
+
+	// segmentHandlers maps the user data passed to the native library to the
+	// handler of the transcription it belongs to
+	segmentHandlersMu sync.Mutex
+	segmentHandlers   = map[uintptr]segmentHandler{}
+	nextSegmentID     uintptr
+)
+
+// segmentCallback returns the C function pointer the native library calls with
+// new segments. purego can only create a limited number of callbacks, so every
+// transcription shares one and it dispatches on the user data.
+func segmentCallback() uintptr {
+	segmentCallbackOnce.Do(func() {
+		segmentCallbackPtr = purego.NewCallback(func(id, first, n uintptr) uintptr {
+			segmentHandlersMu.Lock()
+			handler := segmentHandlers[id]
+			segmentHandlersMu.Unlock()
+
+			if handler == nil || handler(int(first), int(n)) {
+				return 1
+			}
+			return 0
+		})
+	})
+	return segmentCallbackPtr
+}
+
+// registerSegmentHandler registers handler and returns the user data to pass to
+// the native library and a function to unregister it.
+func registerSegmentHandler(handler segmentHandler) (uintptr, func()) {
+	segmentHandlersMu.Lock()
+	defer segmentHandlersMu.Unlock()
+
+	nextSegmentID++
+	id := nextSegmentID
+	segmentHandlers[id] = handler
+	return id, func() {
+		segmentHandlersMu.Lock()
+		delete(segmentHandlers, id)
+		segmentHandlersMu.Unlock()
+	}
+}
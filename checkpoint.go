@@ -0,0 +1,141 @@
+package whisper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultCheckpointInterval is the amount of audio transcribed between checkpoints
+const defaultCheckpointInterval = 5 * time.Minute
+
+// checkpoint is the progress saved to TranscriptionOptions.Checkpoint
+type checkpoint struct {
+	AudioFile string     `json:"audio_file"`
+	Samples   int        `json:"samples"` // total number of samples of the converted audio
+	Offset    int        `json:"offset"`  // number of samples already transcribed
+	Segments  []*Segment `json:"segments"`
+}
+
+// ResumeTranscription continues a transcription that was interrupted while
+// checkpointing to checkpointPath, see TranscriptionOptions.Checkpoint.
+// If the checkpoint does not exist the transcription starts from the beginning.
+func (w *Whisper) ResumeTranscription(audioFile, checkpointPath string, opts TranscriptionOptions) (TranscriptionResult, error) {
+	data, err := readAudioFile(audioFile, opts.conversion())
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+
+	cp := &checkpoint{AudioFile: audioFile, Samples: len(data)}
+	raw, err := os.ReadFile(checkpointPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(raw, cp); err != nil {
+			return TranscriptionResult{}, fmt.Errorf("failed to read checkpoint %s: %w", checkpointPath, err)
+		}
+		if cp.Samples != len(data) || cp.Offset > len(data) {
+			return TranscriptionResult{}, fmt.Errorf("checkpoint %s does not match %s", checkpointPath, audioFile)
+		}
+	case !os.IsNotExist(err):
+		return TranscriptionResult{}, err
+	}
+
+	opts.Checkpoint = checkpointPath
+	return w.transcribeCheckpointed(data, opts, cp)
+}
+
+// transcribeCheckpointed transcribes data in CheckpointInterval chunks starting at
+// cp.Offset, saving progress to opts.Checkpoint after every chunk. The checkpoint
+// file is removed once the transcription completes.
+func (w *Whisper) transcribeCheckpointed(data []float32, opts TranscriptionOptions, cp *checkpoint) (TranscriptionResult, error) {
+	interval := opts.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	chunkSize := int(interval.Seconds() * SampleRate)
+
+	if err := opts.checkDuration(len(data)); err != nil {
+		return TranscriptionResult{Duration: samplesDuration(len(data))}, err
+	}
+
+	onSegment := opts.OnSegment
+	chunkOpts := opts
+	chunkOpts.OnSegment = nil
+	chunkOpts.DeduplicateSegments = false
+
+	stopped := false
+	for cp.Offset < len(data) && !stopped {
+		end := min(cp.Offset+chunkSize, len(data))
+		res, err := w.transcribe(data[cp.Offset:end], chunkOpts, nil)
+		if err != nil {
+			return TranscriptionResult{}, err
+		}
+
+		// Shift the segments onto the timeline of the whole file
+		shiftSegments(res.Segments, cp.Offset, len(cp.Segments))
+		for _, seg := range res.Segments {
+			cp.Segments = append(cp.Segments, seg)
+			if onSegment != nil && !onSegment(seg) {
+				stopped = true
+				break
+			}
+		}
+		cp.Offset = end
+
+		if err := saveCheckpoint(opts.Checkpoint, cp); err != nil {
+			return TranscriptionResult{}, err
+		}
+	}
+
+	if !stopped {
+		os.Remove(opts.Checkpoint)
+	}
+
+	segments := cp.Segments
+	if opts.DeduplicateSegments {
+		segments = deduplicateSegments(segments)
+	}
+	return TranscriptionResult{
+		Segments: segments,
+		Text:     segmentsText(segments, textJoiner(opts.TextJoiner, opts.Language, segments)),
+		Duration: samplesDuration(len(data)),
+	}, nil
+}
+
+// shiftSegments moves segments of a chunk starting at offset samples onto the
+// timeline of the whole audio and renumbers them from firstID
+func shiftSegments(segments []*Segment, offset, firstID int) {
+	shift := int64(time.Duration(offset) * time.Second / SampleRate)
+	for i, seg := range segments {
+		seg.Id = int32(firstID + i)
+		seg.Start += shift
+		seg.End += shift
+		for j := range seg.Words {
+			seg.Words[j].Start += shift
+			seg.Words[j].End += shift
+		}
+	}
+}
+
+// saveCheckpoint atomically writes the checkpoint to path
+func saveCheckpoint(path string, cp *checkpoint) error {
+	raw, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
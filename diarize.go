@@ -0,0 +1,189 @@
+package whisper
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-audio/wav"
+)
+
+// SpeakerSegment is a speaker turn: consecutive segments of the same speaker
+type SpeakerSegment struct {
+	Speaker  string
+	Start    int64 // nanoseconds
+	End      int64 // nanoseconds
+	Text     string
+	Segments []*Segment
+}
+
+// SpeakerSegments groups consecutive segments with the same Speaker into turns.
+// Speakers are set when diarizing with NumSpeakers or ChannelSpeakerNames.
+func (r TranscriptionResult) SpeakerSegments() []SpeakerSegment {
+	turns := []SpeakerSegment{}
+	for _, seg := range r.Segments {
+		if n := len(turns); n > 0 && turns[n-1].Speaker == seg.Speaker {
+			turn := &turns[n-1]
+			turn.End = max(turn.End, seg.End)
+			turn.Segments = append(turn.Segments, seg)
+			turn.Text = segmentsText(turn.Segments, " ")
+			continue
+		}
+		turns = append(turns, SpeakerSegment{
+			Speaker:  seg.Speaker,
+			Start:    seg.Start,
+			End:      seg.End,
+			Text:     strings.TrimSpace(seg.Text),
+			Segments: []*Segment{seg},
+		})
+	}
+	return turns
+}
+
+// speakerJSON is the document written by WriteSpeakerJSON
+type speakerJSON struct {
+	Speakers []string          `json:"speakers"` // in order of first appearance
+	Turns    []speakerTurnJSON `json:"turns"`
+}
+
+type speakerTurnJSON struct {
+	Speaker  string  `json:"speaker"`
+	Start    float64 `json:"start"` // seconds
+	End      float64 `json:"end"`   // seconds
+	Text     string  `json:"text"`
+	Segments []int32 `json:"segments"` // ids of the segments in the turn
+}
+
+// WriteSpeakerJSON writes the speaker turns of SpeakerSegments as a JSON document:
+//
+//	{
+//	  "speakers": ["Agent", "Customer"],
+//	  "turns": [
+//	    {"speaker": "Agent", "start": 0, "end": 2.5, "text": "Hello, how can I help?", "segments": [0]}
+//	  ]
+//	}
+//
+// speakers lists the distinct speakers in order of first appearance, start and
+// end are in seconds and segments holds the ids of the segments of each turn.
+func (r TranscriptionResult) WriteSpeakerJSON(w io.Writer) error {
+	doc := speakerJSON{Speakers: []string{}, Turns: []speakerTurnJSON{}}
+	for _, turn := range r.SpeakerSegments() {
+		if !slices.Contains(doc.Speakers, turn.Speaker) {
+			doc.Speakers = append(doc.Speakers, turn.Speaker)
+		}
+		ids := make([]int32, len(turn.Segments))
+		for i, seg := range turn.Segments {
+			ids[i] = seg.Id
+		}
+		doc.Turns = append(doc.Turns, speakerTurnJSON{
+			Speaker:  turn.Speaker,
+			Start:    time.Duration(turn.Start).Seconds(),
+			End:      time.Duration(turn.End).Seconds(),
+			Text:     turn.Text,
+			Segments: ids,
+		})
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// transcribeChannels transcribes every channel of the audio file separately and
+// merges the segments labeled with opts.ChannelSpeakerNames
+func (w *Whisper) transcribeChannels(audioFile string, opts TranscriptionOptions) (TranscriptionResult, error) {
+	if opts.Decoder != nil {
+		return TranscriptionResult{}, fmt.Errorf("ChannelSpeakerNames cannot be used with a custom Decoder")
+	}
+
+	channels, err := readAudioChannels(audioFile, opts.FFmpegArgs)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	if len(channels) != len(opts.ChannelSpeakerNames) {
+		return TranscriptionResult{}, fmt.Errorf("got %d channel speaker names but %s has %d channels",
+			len(opts.ChannelSpeakerNames), audioFile, len(channels))
+	}
+	if err := opts.checkDuration(len(channels[0])); err != nil {
+		return TranscriptionResult{Duration: samplesDuration(len(channels[0]))}, err
+	}
+
+	channelOpts := opts
+	channelOpts.ChannelSpeakerNames = nil
+	channelOpts.OnSegment = nil
+
+	segments := []*Segment{}
+	for i, data := range channels {
+		res, err := w.transcribe(data, channelOpts, nil)
+		if err != nil {
+			return TranscriptionResult{}, fmt.Errorf("channel %d: %w", i, err)
+		}
+		for _, seg := range res.Segments {
+			seg.Speaker = opts.ChannelSpeakerNames[i]
+		}
+		segments = append(segments, res.Segments...)
+	}
+
+	slices.SortStableFunc(segments, func(a, b *Segment) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	for i, seg := range segments {
+		seg.Id = int32(i)
+		if opts.OnSegment != nil && !opts.OnSegment(seg) {
+			segments = segments[:i+1]
+			break
+		}
+	}
+
+	return TranscriptionResult{
+		Segments: segments,
+		Text:     segmentsText(segments, textJoiner(opts.TextJoiner, opts.Language, segments)),
+		Duration: samplesDuration(len(channels[0])),
+	}, nil
+}
+
+// readAudioChannels converts the audio file to 16kHz keeping its channels and
+// returns the samples of every channel
+func readAudioChannels(audioFile string, ffmpegArgs []string) ([][]float32, error) {
+	dir, err := os.MkdirTemp("", tempDirPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	convertedPath := filepath.Join(dir, "converted.wav")
+	if err := convertAudio(audioFile, convertedPath, "pcm_s16le", 0, ffmpegArgs); err != nil {
+		return nil, fmt.Errorf("failed to convert audio: %w", err)
+	}
+
+	fh, err := os.Open(convertedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	buf, err := wav.NewDecoder(fh).FullPCMBuffer()
+	if err != nil {
+		return nil, err
+	}
+	if buf.Format == nil || buf.Format.SampleRate != SampleRate || buf.Format.NumChannels < 1 {
+		return nil, fmt.Errorf("converted audio has unexpected format: expected %dHz", SampleRate)
+	}
+
+	return deinterleave(buf.AsFloat32Buffer().Data, buf.Format.NumChannels), nil
+}
+
+// deinterleave splits interleaved samples into one slice per channel
+func deinterleave(data []float32, channels int) [][]float32 {
+	out := make([][]float32, channels)
+	for c := range out {
+		out[c] = make([]float32, len(data)/channels)
+		for i := range out[c] {
+			out[c][i] = data[i*channels+c]
+		}
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package whisper
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSpeakerSegments(t *testing.T) {
+	res := TranscriptionResult{Segments: []*Segment{
+		{Text: " Hello, how can I help?", Start: 0, End: 10, Speaker: "Agent"},
+		{Text: " I have a question", Start: 10, End: 20, Speaker: "Customer"},
+		{Text: " about my bill.", Start: 20, End: 30, Speaker: "Customer"},
+	}}
+
+	turns := res.SpeakerSegments()
+	if len(turns) != 2 {
+		t.Fatalf("Expected 2 turns, got %d", len(turns))
+	}
+	if turns[1].Speaker != "Customer" || turns[1].Start != 10 || turns[1].End != 30 {
+		t.Errorf("Unexpected turn %+v", turns[1])
+	}
+	if turns[1].Text != "I have a question about my bill." {
+		t.Errorf("Unexpected turn text %q", turns[1].Text)
+	}
+}
+
+func TestDeinterleave(t *testing.T) {
+	channels := deinterleave([]float32{1, -1, 2, -2, 3, -3}, 2)
+	if len(channels) != 2 || len(channels[0]) != 3 {
+		t.Fatalf("Unexpected channels %v", channels)
+	}
+	if channels[0][2] != 3 || channels[1][1] != -2 {
+		t.Errorf("Unexpected channels %v", channels)
+	}
+}
+
+func TestWriteSpeakerJSON(t *testing.T) {
+	sec := int64(time.Second)
+	res := TranscriptionResult{Segments: []*Segment{
+		{Id: 0, Text: " Hello, how can I help?", Start: 0, End: 2 * sec, Speaker: "Agent"},
+		{Id: 1, Text: " I have a question", Start: 2 * sec, End: 3 * sec, Speaker: "Customer"},
+		{Id: 2, Text: " about my bill.", Start: 3 * sec, End: 4500 * int64(time.Millisecond), Speaker: "Customer"},
+	}}
+
+	var buf bytes.Buffer
+	if err := res.WriteSpeakerJSON(&buf); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+
+	want := `{"speakers":["Agent","Customer"],"turns":[` +
+		`{"speaker":"Agent","start":0,"end":2,"text":"Hello, how can I help?","segments":[0]},` +
+		`{"speaker":"Customer","start":2,"end":4.5,"text":"I have a question about my bill.","segments":[1,2]}]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,171 @@
+package whisper
+
+import (
+	"strings"
+	"unicode"
+)
+
+// EditOp is the kind of a word edit in a TranscriptDiff
+type EditOp int
+
+const (
+	// EditSubstitute replaces a word of the first transcript with a word of the second
+	EditSubstitute EditOp = iota
+	// EditDelete removes a word of the first transcript
+	EditDelete
+	// EditInsert adds a word of the second transcript
+	EditInsert
+)
+
+// WordEdit is a single word difference between two transcripts. From is empty
+// for insertions and To is empty for deletions.
+type WordEdit struct {
+	Op       EditOp
+	From, To string
+	Index    int // position of the word in the first transcript
+}
+
+// TranscriptDiff is the word level difference between two transcripts
+type TranscriptDiff struct {
+	Edits         []WordEdit
+	Substitutions int
+	Deletions     int
+	Insertions    int
+	// WER is the word error rate of the second transcript against the first:
+	// (substitutions + deletions + insertions) / words in the first transcript
+	WER float64
+}
+
+// DiffResults compares the text of two results word by word, treating a as the
+// reference. Words are compared case-insensitively without punctuation, and
+// characters of scripts written without spaces count as words. The alignment is
+// quadratic in the length of the differing part of the transcripts.
+func DiffResults(a, b TranscriptionResult) TranscriptDiff {
+	return diffWords(splitWords(a.Text), splitWords(b.Text))
+}
+
+// diffWords returns the minimal word edits turning ref into hyp
+func diffWords(ref, hyp []string) TranscriptDiff {
+	// Matching prefixes and suffixes need no alignment, which keeps the table
+	// small for similar transcripts
+	prefix := 0
+	for prefix < len(ref) && prefix < len(hyp) && ref[prefix] == hyp[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ref)-prefix && suffix < len(hyp)-prefix && ref[len(ref)-1-suffix] == hyp[len(hyp)-1-suffix] {
+		suffix++
+	}
+	a, b := ref[prefix:len(ref)-suffix], hyp[prefix:len(hyp)-suffix]
+
+	// dist[i][j] is the edit distance between a[:i] and b[:j]
+	dist := make([][]int, len(a)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(b)+1)
+		dist[i][0] = i
+	}
+	for j := range dist[0] {
+		dist[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			dist[i][j] = min(dist[i-1][j]+1, dist[i][j-1]+1, dist[i-1][j-1]+cost)
+		}
+	}
+
+	var diff TranscriptDiff
+	for i, j := len(a), len(b); i > 0 || j > 0; {
+		switch {
+		case i > 0 && j > 0 && a[i-1] == b[j-1] && dist[i][j] == dist[i-1][j-1]:
+			i, j = i-1, j-1
+			continue
+		case i > 0 && j > 0 && dist[i][j] == dist[i-1][j-1]+1:
+			diff.Edits = append(diff.Edits, WordEdit{Op: EditSubstitute, From: a[i-1], To: b[j-1], Index: prefix + i - 1})
+			diff.Substitutions++
+			i, j = i-1, j-1
+		case i > 0 && dist[i][j] == dist[i-1][j]+1:
+			diff.Edits = append(diff.Edits, WordEdit{Op: EditDelete, From: a[i-1], Index: prefix + i - 1})
+			diff.Deletions++
+			i--
+		default:
+			diff.Edits = append(diff.Edits, WordEdit{Op: EditInsert, To: b[j-1], Index: prefix + i})
+			diff.Insertions++
+			j--
+		}
+	}
+	// The backtrace collects the edits from the end
+	for l, r := 0, len(diff.Edits)-1; l < r; l, r = l+1, r-1 {
+		diff.Edits[l], diff.Edits[r] = diff.Edits[r], diff.Edits[l]
+	}
+
+	diff.WER = errorRate(diff.Substitutions+diff.Deletions+diff.Insertions, len(ref))
+	return diff
+}
+
+// EvalOptions controls the text normalization of Evaluate. By default both texts
+// are lowercased and stripped of punctuation, like DiffResults.
+type EvalOptions struct {
+	KeepCase        bool // compare case-sensitively
+	KeepPunctuation bool // keep punctuation, so "you." and "you" differ
+}
+
+// EvalResult holds the error rates of a transcript against a reference
+type EvalResult struct {
+	// WER is the word error rate: word edits / reference words
+	WER        float64
+	WordErrors int
+	Words      int // words in the reference
+	// CER is the character error rate: character edits / reference characters,
+	// counting single spaces between words
+	CER        float64
+	CharErrors int
+	Chars      int // characters in the reference
+}
+
+// Evaluate scores the text of the hypothesis against a reference transcript,
+// e.g. from a labeled dataset, with word and character error rates. Characters of
+// scripts written without spaces count as words.
+func Evaluate(hypothesis TranscriptionResult, reference string, opts EvalOptions) EvalResult {
+	hyp, ref := opts.normalize(hypothesis.Text), opts.normalize(reference)
+
+	refWords, hypWords := tokenizeWords(ref), tokenizeWords(hyp)
+	refChars, hypChars := []rune(ref), []rune(hyp)
+	res := EvalResult{
+		WordErrors: levenshtein(refWords, hypWords),
+		Words:      len(refWords),
+		CharErrors: levenshtein(refChars, hypChars),
+		Chars:      len(refChars),
+	}
+	res.WER = errorRate(res.WordErrors, res.Words)
+	res.CER = errorRate(res.CharErrors, res.Chars)
+	return res
+}
+
+// normalize applies the options to the text and collapses whitespace
+func (o EvalOptions) normalize(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case !o.KeepPunctuation && unicode.IsPunct(r):
+			return -1
+		case !o.KeepCase:
+			return unicode.ToLower(r)
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// errorRate returns edits / total, or 1 for edits against an empty reference
+func errorRate(edits, total int) float64 {
+	switch {
+	case total > 0:
+		return float64(edits) / float64(total)
+	case edits > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package whisper
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffResults(t *testing.T) {
+	a := TranscriptionResult{Text: "And so, my fellow Americans: ask not what your country can do for you."}
+	b := TranscriptionResult{Text: "and so my fellow american ask what your country can do for you today"}
+
+	diff := DiffResults(a, b)
+	want := []WordEdit{
+		{Op: EditSubstitute, From: "americans", To: "american", Index: 4},
+		{Op: EditDelete, From: "not", Index: 6},
+		{Op: EditInsert, To: "today", Index: 14},
+	}
+	if !slices.Equal(diff.Edits, want) {
+		t.Errorf("Unexpected edits %+v", diff.Edits)
+	}
+	if diff.Substitutions != 1 || diff.Deletions != 1 || diff.Insertions != 1 {
+		t.Errorf("Unexpected counts %+v", diff)
+	}
+	if diff.WER != 3.0/14 {
+		t.Errorf("Expected WER 3/14, got %v", diff.WER)
+	}
+
+	if diff := DiffResults(a, a); len(diff.Edits) != 0 || diff.WER != 0 {
+		t.Errorf("Expected no difference, got %+v", diff)
+	}
+	if diff := DiffResults(TranscriptionResult{Text: "今天好"}, TranscriptionResult{Text: "今天很好"}); diff.Insertions != 1 {
+		t.Errorf("Expected one inserted character, got %+v", diff)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	hyp := TranscriptionResult{Text: " And so my fellow american, ask not."}
+	reference := "And so, my fellow Americans: ask not."
+
+	res := Evaluate(hyp, reference, EvalOptions{})
+	if res.WordErrors != 1 || res.Words != 7 || res.WER != 1.0/7 {
+		t.Errorf("Unexpected word errors %+v", res)
+	}
+	// "and so my fellow americans ask not" vs "... american ask not"
+	if res.CharErrors != 1 || res.Chars != 34 || res.CER != 1.0/34 {
+		t.Errorf("Unexpected character errors %+v", res)
+	}
+
+	strict := Evaluate(hyp, reference, EvalOptions{KeepCase: true, KeepPunctuation: true})
+	// "so" vs "so,", "american," vs "Americans:"
+	if strict.WordErrors != 2 {
+		t.Errorf("Expected 2 word errors with case and punctuation, got %+v", strict)
+	}
+
+	if res := Evaluate(TranscriptionResult{}, "", EvalOptions{}); res.WER != 0 || res.CER != 0 {
+		t.Errorf("Expected no errors for empty texts, got %+v", res)
+	}
+}
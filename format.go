@@ -0,0 +1,238 @@
+package whisper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormattedLines renders each segment as "[MM:SS.mmm --> MM:SS.mmm] text",
+// with an hours field added for timestamps of an hour or more.
+func (r TranscriptionResult) FormattedLines() []string {
+	lines := make([]string, 0, len(r.Segments))
+	for _, seg := range r.Segments {
+		lines = append(lines, fmt.Sprintf("[%s --> %s] %s",
+			formatClock(time.Duration(seg.Start)), formatClock(time.Duration(seg.End)), strings.TrimSpace(seg.Text)))
+	}
+	return lines
+}
+
+// WriteWhisperStyle writes the segments in the format the whisper.cpp command line
+// prints, "[HH:MM:SS.mmm --> HH:MM:SS.mmm]  text" with two spaces after the bracket,
+// for tools that parse its output. The segment text is written as decoded, so
+// its usual leading space makes a third one, exactly like whisper.cpp.
+func (r TranscriptionResult) WriteWhisperStyle(w io.Writer) error {
+	var b strings.Builder
+	for _, seg := range r.Segments {
+		fmt.Fprintf(&b, "[%s --> %s]  %s\n", FormatTimestamp(seg.Start, '.'), FormatTimestamp(seg.End, '.'), seg.Text)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// FormatTimestamp formats a segment time in nanoseconds (Segment.Start/End) as
+// HH:MM:SS<sep>mmm, rounded to the nearest millisecond. Use ',' for SRT and '.' for WebVTT.
+func FormatTimestamp(t int64, sep rune) string {
+	h, m, s, ms := splitTimestamp(time.Duration(t), time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", h, m, s, sep, ms)
+}
+
+// ParseTimestamp parses HH:MM:SS.mmm, HH:MM:SS,mmm or MM:SS.mmm (any number of
+// fractional digits) into nanoseconds, the unit of Segment.Start/End.
+func ParseTimestamp(s string) (int64, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	secPart, fracPart, _ := strings.Cut(strings.Replace(parts[len(parts)-1], ",", ".", 1), ".")
+	fields := append(parts[:len(parts)-1:len(parts)-1], secPart)
+
+	var d time.Duration
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 32)
+		// Minutes and seconds must be below 60, only the leading field may be larger
+		if err != nil || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		d = d*60 + time.Duration(n)
+	}
+	d *= time.Second
+
+	if fracPart != "" {
+		if len(fracPart) > 9 {
+			return 0, fmt.Errorf("invalid timestamp %q: too many fractional digits", s)
+		}
+		n, err := strconv.ParseUint(fracPart, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		for range 9 - len(fracPart) {
+			n *= 10
+		}
+		d += time.Duration(n)
+	}
+	return int64(d), nil
+}
+
+// splitTimestamp rounds d to unit and splits it into hours, minutes, seconds and
+// the remaining fraction expressed in units. Negative durations are clamped to zero.
+func splitTimestamp(d, unit time.Duration) (h, m, s, frac int64) {
+	if d < 0 {
+		d = 0
+	}
+	n := int64(d.Round(unit) / unit)
+	perSecond := int64(time.Second / unit)
+	secs := n / perSecond
+	return secs / 3600, secs / 60 % 60, secs % 60, n % perSecond
+}
+
+// formatClock formats d as MM:SS.mmm, or HH:MM:SS.mmm if d is an hour or more
+func formatClock(d time.Duration) string {
+	h, m, s, ms := splitTimestamp(d, time.Millisecond)
+	if h > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+	}
+	return fmt.Sprintf("%02d:%02d.%03d", m, s, ms)
+}
+
+// ASSStyle is the caption style used by WriteASS. Zero values use the defaults
+// Arial, size 20, white.
+type ASSStyle struct {
+	FontName string
+	FontSize int
+	Color    string // primary text color as #RRGGBB
+}
+
+// WriteASS writes the segments as an Advanced SubStation Alpha (.ass) subtitle file
+// with a single style. The speaker label, if any, is used as the dialogue name.
+func (r TranscriptionResult) WriteASS(w io.Writer, style ASSStyle) error {
+	if style.FontName == "" {
+		style.FontName = "Arial"
+	}
+	if style.FontSize <= 0 {
+		style.FontSize = 20
+	}
+	if style.Color == "" {
+		style.Color = "#FFFFFF"
+	}
+	color, err := assColor(style.Color)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("[Script Info]\nScriptType: v4.00+\nPlayResX: 384\nPlayResY: 288\n\n")
+	b.WriteString("[V4+ Styles]\n")
+	b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	fmt.Fprintf(&b, "Style: Default,%s,%d,%s,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,10,10,1\n\n",
+		style.FontName, style.FontSize, color)
+	b.WriteString("[Events]\n")
+	b.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	for _, seg := range r.Segments {
+		text := strings.ReplaceAll(strings.TrimSpace(seg.Text), "\n", `\N`)
+		fmt.Fprintf(&b, "Dialogue: 0,%s,%s,Default,%s,0,0,0,,%s\n",
+			formatASSTime(time.Duration(seg.Start)), formatASSTime(time.Duration(seg.End)), seg.Speaker, text)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// formatASSTime formats d as H:MM:SS.cc
+func formatASSTime(d time.Duration) string {
+	h, m, s, cs := splitTimestamp(d, 10*time.Millisecond)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, cs)
+}
+
+// assColor converts #RRGGBB to the ASS &H00BBGGRR notation
+func assColor(hex string) (string, error) {
+	rgb, ok := strings.CutPrefix(hex, "#")
+	if _, err := strconv.ParseUint(rgb, 16, 32); !ok || len(rgb) != 6 || err != nil {
+		return "", fmt.Errorf("invalid ASS color %q: expected #RRGGBB", hex)
+	}
+	return "&H00" + strings.ToUpper(rgb[4:6]+rgb[2:4]+rgb[0:2]), nil
+}
+
+// wordJSON is an element of the array written by WriteWordsJSON
+type wordJSON struct {
+	Word    string  `json:"word"`
+	StartMs int64   `json:"start_ms"`
+	EndMs   int64   `json:"end_ms"`
+	Prob    float32 `json:"prob"`
+}
+
+// WriteWordsJSON writes the words of all segments as a flat JSON array of
+// {"word", "start_ms", "end_ms", "prob"} objects, the shape media players use for
+// click-to-seek transcripts. Words are only available when transcribing with
+// WordTimestamps.
+func (r TranscriptionResult) WriteWordsJSON(w io.Writer) error {
+	words := []wordJSON{}
+	for _, seg := range r.Segments {
+		for _, word := range seg.Words {
+			words = append(words, wordJSON{
+				Word:    word.Text,
+				StartMs: time.Duration(word.Start).Milliseconds(),
+				EndMs:   time.Duration(word.End).Milliseconds(),
+				Prob:    word.Probability,
+			})
+		}
+	}
+	return json.NewEncoder(w).Encode(words)
+}
+
+// WriteCTM writes the words of all segments in the NIST CTM format used by Kaldi
+// and sclite, one "<fileID> 1 <start> <duration> <word> <confidence>" line per
+// word with times in seconds. It returns an error if the result has no words,
+// which are only available when transcribing with WordTimestamps.
+func (r TranscriptionResult) WriteCTM(w io.Writer, fileID string) error {
+	var b strings.Builder
+	for _, seg := range r.Segments {
+		for _, word := range seg.Words {
+			text := strings.Join(strings.Fields(word.Text), "_")
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s 1 %.3f %.3f %s %.3f\n", fileID,
+				time.Duration(word.Start).Seconds(), time.Duration(word.End-word.Start).Seconds(), text, word.Probability)
+		}
+	}
+	if b.Len() == 0 {
+		return fmt.Errorf("no word timestamps to write as CTM, transcribe with WordTimestamps")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// StartFrame returns the frame of a video at fps frames per second in which the
+// segment starts, rounded down so the frame covers the start. It returns 0 for a
+// non-positive fps.
+func (s *Segment) StartFrame(fps float64) int64 {
+	return timeToFrame(s.Start, fps, math.Floor)
+}
+
+// EndFrame returns the frame boundary at which the segment has ended, rounded up
+// so the range [StartFrame, EndFrame) covers the whole segment. It returns 0 for
+// a non-positive fps.
+func (s *Segment) EndFrame(fps float64) int64 {
+	return timeToFrame(s.End, fps, math.Ceil)
+}
+
+// timeToFrame converts t in nanoseconds to a frame number with the rounding
+// function. Times within a nanosecond of a frame boundary snap to it, so
+// float error in rates such as 29.97 does not shift exact boundaries.
+func timeToFrame(t int64, fps float64, round func(float64) float64) int64 {
+	if fps <= 0 {
+		return 0
+	}
+	frames := time.Duration(t).Seconds() * fps
+	if nearest := math.Round(frames); math.Abs(frames-nearest) < fps*1e-9 {
+		return int64(nearest)
+	}
+	return int64(round(frames))
+}
@@ -0,0 +1,222 @@
+package whisper
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormattedLines(t *testing.T) {
+	res := TranscriptionResult{Segments: []*Segment{
+		{Text: " And so my fellow Americans", Start: 0, End: int64(2400 * time.Millisecond)},
+		{Text: " ask not", Start: int64(time.Hour + 2*time.Second), End: int64(time.Hour + 3*time.Second)},
+	}}
+
+	lines := res.FormattedLines()
+	expected := []string{
+		"[00:00.000 --> 00:02.400] And so my fellow Americans",
+		"[01:00:02.000 --> 01:00:03.000] ask not",
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, expected[i], line)
+		}
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	res := TranscriptionResult{Segments: []*Segment{
+		{Text: " And so my fellow Americans", Start: 0, End: int64(2400 * time.Millisecond)},
+	}}
+
+	var b strings.Builder
+	if err := res.WriteASS(&b, ASSStyle{Color: "#FF8000"}); err != nil {
+		t.Fatalf("Failed to write ASS: %v", err)
+	}
+
+	out := b.String()
+	for _, want := range []string{
+		"[Script Info]",
+		"Style: Default,Arial,20,&H000080FF,",
+		"Dialogue: 0,0:00:00.00,0:00:02.40,Default,,0,0,0,,And so my fellow Americans\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if err := res.WriteASS(&b, ASSStyle{Color: "red"}); err == nil {
+		t.Error("Expected error for invalid color")
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		t    time.Duration
+		sep  rune
+		want string
+	}{
+		{0, ',', "00:00:00,000"},
+		{2400 * time.Millisecond, ',', "00:00:02,400"},
+		{time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond, '.', "01:02:03.004"},
+		// Rounding at millisecond boundaries
+		{999*time.Microsecond + 499*time.Nanosecond, '.', "00:00:00.001"},
+		{1499 * time.Microsecond, '.', "00:00:00.001"},
+		{1500 * time.Microsecond, '.', "00:00:00.002"},
+		{59*time.Second + 999500*time.Microsecond, '.', "00:01:00.000"},
+		{-time.Second, '.', "00:00:00.000"},
+	}
+	for _, tt := range tests {
+		if got := FormatTimestamp(int64(tt.t), tt.sep); got != tt.want {
+			t.Errorf("FormatTimestamp(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"00:00:02,400", 2400 * time.Millisecond},
+		{"01:02:03.004", time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond},
+		{"00:02.4", 2400 * time.Millisecond},
+		{"0:00:01.50", 1500 * time.Millisecond},
+		{"00:00:05", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.s)
+		if err != nil {
+			t.Errorf("ParseTimestamp(%q) failed: %v", tt.s, err)
+			continue
+		}
+		if got != int64(tt.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tt.s, time.Duration(got), tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "12", "00:61:00.000", "aa:bb:cc", "00:00:01.0000000001", "00:00:-1.000"} {
+		if _, err := ParseTimestamp(s); err == nil {
+			t.Errorf("ParseTimestamp(%q) expected error", s)
+		}
+	}
+
+	// Round trip
+	for _, ms := range []int64{0, 1, 999, 1000, 3599999, 3600000, 86399999} {
+		d := int64(time.Duration(ms) * time.Millisecond)
+		got, err := ParseTimestamp(FormatTimestamp(d, ','))
+		if err != nil || got != d {
+			t.Errorf("Round trip of %dms gave %v, %v", ms, time.Duration(got), err)
+		}
+	}
+}
+
+func TestWriteWordsJSON(t *testing.T) {
+	ms := int64(time.Millisecond)
+	res := TranscriptionResult{Segments: []*Segment{
+		{Text: " And so", Words: []Word{
+			{Text: "And", Start: 0, End: 320 * ms, Probability: 0.5},
+			{Text: "so", Start: 320 * ms, End: 600 * ms, Probability: 1},
+		}},
+		{Text: " my", Words: []Word{{Text: "my", Start: 1000 * ms, End: 1200 * ms, Probability: 0.75}}},
+	}}
+
+	var b strings.Builder
+	if err := res.WriteWordsJSON(&b); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	want := `[{"word":"And","start_ms":0,"end_ms":320,"prob":0.5},` +
+		`{"word":"so","start_ms":320,"end_ms":600,"prob":1},` +
+		`{"word":"my","start_ms":1000,"end_ms":1200,"prob":0.75}]` + "\n"
+	if b.String() != want {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteSegment(t *testing.T) {
+	seg := &Segment{Id: 0, Text: " Hello there.", Start: int64(1500 * time.Millisecond), End: int64(3 * time.Second)}
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatSRT, "1\n00:00:01,500 --> 00:00:03,000\nHello there.\n\n"},
+		{FormatVTT, "00:00:01.500 --> 00:00:03.000\nHello there.\n\n"},
+		{FormatJSONL, `{"id":0,"start":1.5,"end":3,"text":" Hello there."}` + "\n"},
+		{FormatText, "Hello there.\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := writeSegment(&b, tt.format, 1, seg); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, b.String(), tt.want)
+		}
+	}
+}
+
+func TestWriteCTM(t *testing.T) {
+	ms := int64(time.Millisecond)
+	res := TranscriptionResult{Segments: []*Segment{
+		{Text: " And so", Words: []Word{
+			{Text: " And", Start: 0, End: 320 * ms, Probability: 0.5},
+			{Text: "so", Start: 320 * ms, End: 600 * ms, Probability: 1},
+		}},
+	}}
+
+	var b strings.Builder
+	if err := res.WriteCTM(&b, "utt1"); err != nil {
+		t.Fatalf("Failed to write CTM: %v", err)
+	}
+	want := "utt1 1 0.000 0.320 And 0.500\nutt1 1 0.320 0.280 so 1.000\n"
+	if b.String() != want {
+		t.Errorf("Unexpected CTM:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	noWords := TranscriptionResult{Segments: []*Segment{{Text: " And so"}}}
+	if err := noWords.WriteCTM(&b, "utt1"); err == nil {
+		t.Error("Expected error for result without word timestamps")
+	}
+}
+
+func TestSegmentFrames(t *testing.T) {
+	ms := int64(time.Millisecond)
+	seg := &Segment{Start: 1010 * ms, End: 2010 * ms}
+	if got := seg.StartFrame(25); got != 25 {
+		t.Errorf("Expected start frame 25 at 25fps, got %d", got)
+	}
+	if got := seg.EndFrame(25); got != 51 {
+		t.Errorf("Expected end frame 51 at 25fps, got %d", got)
+	}
+
+	// Exact boundaries are not rounded away, even at NTSC rates
+	ntsc := 30000.0 / 1001
+	exact := &Segment{Start: 1001 * ms, End: int64(1001 * 100 * time.Millisecond / 30)}
+	if got := exact.StartFrame(ntsc); got != 30 {
+		t.Errorf("Expected start frame 30 at 29.97fps, got %d", got)
+	}
+	if got := exact.EndFrame(ntsc); got != 100 {
+		t.Errorf("Expected end frame 100 at 29.97fps, got %d", got)
+	}
+
+	if got := seg.StartFrame(0); got != 0 {
+		t.Errorf("Expected 0 for an invalid fps, got %d", got)
+	}
+}
+
+func TestWriteWhisperStyle(t *testing.T) {
+	res := TranscriptionResult{Segments: []*Segment{{
+		Text: " And so my fellow Americans, ask not what your country can do for you, ask what you can do for your country.",
+		End:  int64(11 * time.Second),
+	}}}
+
+	var b strings.Builder
+	if err := res.WriteWhisperStyle(&b); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	// Output of whisper.cpp's main for samples/jfk.wav
+	want := "[00:00:00.000 --> 00:00:11.000]   And so my fellow Americans, ask not what your country can do for you, ask what you can do for your country.\n"
+	if b.String() != want {
+		t.Errorf("Unexpected output:\n%q\nwant:\n%q", b.String(), want)
+	}
+}
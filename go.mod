@@ -4,11 +4,9 @@ go 1.25.5
 
 require (
 	github.com/ebitengine/purego v0.9.1
+	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.1.0
 	golang.org/x/sys v0.30.0
 )
 
-require (
-	github.com/go-audio/audio v1.0.0 // indirect
-	github.com/go-audio/riff v1.0.0 // indirect
-)
+require github.com/go-audio/riff v1.0.0 // indirect
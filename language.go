@@ -0,0 +1,148 @@
+package whisper
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+)
+
+// ErrLanguageUncertain is returned by Transcribe when the language is auto-detected
+// with a probability below TranscriptionOptions.MinLanguageProb and no
+// FallbackLanguage is set
+var ErrLanguageUncertain = errors.New("detected language probability is below the minimum")
+
+// DetectLanguage detects the spoken language of 16kHz mono samples with the loaded
+// model, using the first 30 seconds. It returns the language code, e.g. "de", and
+// its probability.
+func (w *Whisper) DetectLanguage(samples []float32, threads uint32) (string, float32, error) {
+	w.lock()
+	defer w.unlock()
+
+	if !w.state.modelLoaded {
+		return "", 0, ErrModelNotLoaded
+	}
+
+	probs, best, err := w.languageProbs(samples, threads)
+	if err != nil {
+		return "", 0, err
+	}
+	return w.cppLangStr(best), probs[best], nil
+}
+
+// LanguageScore is the probability of a language in DetectLanguageRanked
+type LanguageScore struct {
+	Code string
+	Prob float32
+}
+
+// DetectLanguageRanked detects the spoken language of the audio file and returns
+// every language the model knows, most probable first. Like DetectLanguage it
+// uses the first 30 seconds.
+func (w *Whisper) DetectLanguageRanked(audioFile string) ([]LanguageScore, error) {
+	// Let ffmpeg stop after the part the detection uses
+	conv := conversion{ffmpegArgs: []string{"-t", strconv.Itoa(languageDetectionSeconds)}}
+	data, err := readAudioFile(audioFile, conv)
+	if err != nil {
+		return nil, err
+	}
+
+	w.lock()
+	defer w.unlock()
+
+	if !w.state.modelLoaded {
+		return nil, ErrModelNotLoaded
+	}
+
+	// Same default as whisper.cpp
+	probs, _, err := w.languageProbs(data, uint32(min(4, runtime.NumCPU())))
+	if err != nil {
+		return nil, err
+	}
+
+	return w.rankLanguages(probs), nil
+}
+
+// rankLanguages returns the scores of every language id, most probable first.
+// The caller must hold the lock.
+func (w *Whisper) rankLanguages(probs []float32) []LanguageScore {
+	scores := make([]LanguageScore, len(probs))
+	for id, p := range probs {
+		scores[id] = LanguageScore{Code: w.cppLangStr(id), Prob: p}
+	}
+	sortScores(scores)
+	return scores
+}
+
+// sortScores sorts the scores by descending probability
+func sortScores(scores []LanguageScore) {
+	slices.SortStableFunc(scores, func(a, b LanguageScore) int { return cmp.Compare(b.Prob, a.Prob) })
+}
+
+// candidateScores keeps the scores of the candidate languages and renormalizes
+// their probabilities to sum to 1, most probable first
+func candidateScores(scores []LanguageScore, candidates []string) ([]LanguageScore, error) {
+	kept := make([]LanguageScore, 0, len(candidates))
+	var total float32
+	for _, code := range candidates {
+		i := slices.IndexFunc(scores, func(s LanguageScore) bool { return s.Code == code })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown candidate language %q", code)
+		}
+		kept = append(kept, scores[i])
+		total += scores[i].Prob
+	}
+	for i := range kept {
+		if total > 0 {
+			kept[i].Prob /= total
+		} else {
+			kept[i].Prob = 1 / float32(len(kept))
+		}
+	}
+	sortScores(kept)
+	return kept, nil
+}
+
+// languageDetectionSeconds is the length of audio whisper detects the language from
+const languageDetectionSeconds = 30
+
+// languageProbs returns the probability of every language id and the most probable
+// id. Only the first 30 seconds are passed on, the native call computes the mel
+// spectrogram of everything it gets. The caller must hold the lock.
+func (w *Whisper) languageProbs(samples []float32, threads uint32) ([]float32, int, error) {
+	samples = samples[:min(len(samples), languageDetectionSeconds*SampleRate)]
+	probs := make([]float32, w.cppLangMaxID()+1)
+	best := w.cppDetectLanguage(samples, uintptr(len(samples)), max(threads, 1), probs)
+	if best < 0 {
+		return nil, 0, &NativeError{Op: "detect_language", Code: best}
+	}
+	return probs, best, nil
+}
+
+// resolveLanguage detects the language of the samples among CandidateLanguages, if
+// set, and applies MinLanguageProb and FallbackLanguage. The caller must hold the lock.
+func (w *Whisper) resolveLanguage(samples []float32, opts TranscriptionOptions) (string, error) {
+	probs, best, err := w.languageProbs(samples, opts.Threads)
+	if err != nil {
+		return "", err
+	}
+
+	language, prob := w.cppLangStr(best), probs[best]
+	if len(opts.CandidateLanguages) > 0 {
+		scores, err := candidateScores(w.rankLanguages(probs), opts.CandidateLanguages)
+		if err != nil {
+			return "", err
+		}
+		language, prob = scores[0].Code, scores[0].Prob
+	}
+
+	if prob >= opts.MinLanguageProb {
+		return language, nil
+	}
+	if opts.FallbackLanguage != "" {
+		return opts.FallbackLanguage, nil
+	}
+	return "", fmt.Errorf("%w: %s with %.2f, need %.2f", ErrLanguageUncertain, language, prob, opts.MinLanguageProb)
+}
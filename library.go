@@ -0,0 +1,356 @@
+package whisper
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/cpu"
+)
+
+// LibraryAsset describes a whisper library file
+type LibraryAsset struct {
+	Name    string // file name, e.g. libgowhisper-avx2.so
+	Path    string // full path to the file
+	Variant string // CPU variant: fallback, avx, avx2, avx512, or empty if unknown
+	Size    int64
+}
+
+// ScanLibraries lists the whisper libraries for the current platform found in dir.
+// It complements the automatic selection in New by exposing every installed variant.
+func ScanLibraries(dir string) []LibraryAsset {
+	prefix, ext := libraryAffixes(runtime.GOOS)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	assets := []LibraryAsset{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix+"gowhisper") || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		assets = append(assets, LibraryAsset{
+			Name:    name,
+			Path:    filepath.Join(dir, name),
+			Variant: detectVariant(name),
+			Size:    info.Size(),
+		})
+	}
+
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+	return assets
+}
+
+// detectVariant extracts the CPU variant from a library file name such as
+// libgowhisper-avx2.so or libgowhisper-fallback-arm64.so
+func detectVariant(name string) string {
+	_, rest, ok := strings.Cut(name, "gowhisper-")
+	if !ok {
+		return ""
+	}
+	end := strings.IndexAny(rest, "-.")
+	if end < 0 {
+		return rest
+	}
+	return rest[:end]
+}
+
+// knownArches are the GOARCH values a library file name may be qualified with
+var knownArches = []string{"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le",
+	"mipsle", "ppc64", "ppc64le", "riscv64", "s390x"}
+
+// detectArch extracts the architecture from an arch-qualified library file name
+// such as libgowhisper-fallback-arm64.so, or returns "" for unqualified names.
+// Other suffixes, like the toolchain in gowhisper-fallback-msvc.dll, are not
+// architectures.
+func detectArch(name string) string {
+	_, rest, ok := strings.Cut(name, "gowhisper-")
+	if !ok {
+		return ""
+	}
+	_, ext := libraryAffixes(runtime.GOOS)
+	parts := strings.Split(strings.TrimSuffix(rest, ext), "-")
+	if arch := parts[len(parts)-1]; len(parts) > 1 && slices.Contains(knownArches, arch) {
+		return arch
+	}
+	return ""
+}
+
+// VariantSelector picks the library to load among installed assets, or returns
+// nil if none is suitable. Use it with NewWithSelector:
+//
+//	w, err := whisper.NewWithSelector(dir, whisper.SelectFastestSupported)
+//
+// The built-in selectors ignore libraries built for another architecture.
+type VariantSelector func(assets []LibraryAsset) *LibraryAsset
+
+// NewWithSelector creates a Whisper instance from the library that selector picks
+// among the libraries ScanLibraries finds in dir, instead of the fallback build
+// New loads from directories. An empty dir is the current directory.
+func NewWithSelector(dir string, selector VariantSelector) (*Whisper, error) {
+	if dir == "" {
+		dir = "."
+	}
+	asset := selector(ScanLibraries(dir))
+	if asset == nil {
+		return nil, fmt.Errorf("no whisper library in %s matches the selector", dir)
+	}
+	return New(asset.Path)
+}
+
+// SelectFallback selects the fallback build, which runs on any CPU. This is the
+// policy New uses for directories.
+func SelectFallback(assets []LibraryAsset) *LibraryAsset {
+	return selectVariant(assets, "fallback")
+}
+
+// SelectFastestSupported selects the most optimized build the CPU supports,
+// trying avx512, avx2, avx and finally fallback
+func SelectFastestSupported(assets []LibraryAsset) *LibraryAsset {
+	variants := []string{"fallback"}
+	if cpu.X86.HasAVX {
+		variants = append([]string{"avx"}, variants...)
+	}
+	if cpu.X86.HasAVX2 {
+		variants = append([]string{"avx2"}, variants...)
+	}
+	if cpu.X86.HasAVX512F {
+		variants = append([]string{"avx512"}, variants...)
+	}
+	for _, variant := range variants {
+		if asset := selectVariant(assets, variant); asset != nil {
+			return asset
+		}
+	}
+	return nil
+}
+
+// SelectSmallest selects the smallest library file
+func SelectSmallest(assets []LibraryAsset) *LibraryAsset {
+	var best *LibraryAsset
+	for i := range assets {
+		if !assetForArch(assets[i]) {
+			continue
+		}
+		if best == nil || assets[i].Size < best.Size {
+			best = &assets[i]
+		}
+	}
+	return best
+}
+
+// selectVariant returns the asset of the variant for the current architecture,
+// preferring an arch-qualified build like findBestLibrary
+func selectVariant(assets []LibraryAsset, variant string) *LibraryAsset {
+	var best *LibraryAsset
+	for i := range assets {
+		if assets[i].Variant != variant || !assetForArch(assets[i]) {
+			continue
+		}
+		if best == nil || detectArch(assets[i].Name) != "" {
+			best = &assets[i]
+		}
+	}
+	return best
+}
+
+// assetForArch reports whether the asset can be loaded on the current architecture
+func assetForArch(asset LibraryAsset) bool {
+	arch := detectArch(asset.Name)
+	return arch == "" || arch == runtime.GOARCH
+}
+
+// libraryFormat returns the binary format of the file at path based on its magic bytes
+func libraryFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return "", err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte{0x7f, 'E', 'L', 'F'}):
+		return "ELF", nil
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return "PE", nil
+	case bytes.Equal(magic, []byte{0xfe, 0xed, 0xfa, 0xce}), bytes.Equal(magic, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.Equal(magic, []byte{0xce, 0xfa, 0xed, 0xfe}), bytes.Equal(magic, []byte{0xcf, 0xfa, 0xed, 0xfe}),
+		bytes.Equal(magic, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		return "Mach-O", nil
+	}
+	return "", nil
+}
+
+// checkLibraryFormat verifies that the library at path was built for goos,
+// turning a cryptic dlopen failure into an actionable error
+func checkLibraryFormat(path, goos string) error {
+	format, err := libraryFormat(path)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("library %s is empty or truncated, it may be a failed download", path)
+	}
+	if err != nil {
+		// Let the loader report missing or unreadable files
+		return nil
+	}
+
+	expected := "ELF"
+	switch goos {
+	case "darwin":
+		expected = "Mach-O"
+	case "windows":
+		expected = "PE"
+	}
+
+	if format == "" {
+		return fmt.Errorf("library %s is not a shared library (unrecognized file format)", path)
+	}
+	if format != expected {
+		return fmt.Errorf("library %s is %s but platform is %s (expected %s)", path, format, goos, expected)
+	}
+	return nil
+}
+
+// checkGlibcVersion verifies that the system glibc is at least the version the
+// library at path was linked against. Libraries built on newer distros otherwise
+// fail in dlopen with a symbol version error. Systems without glibc are not checked.
+func checkGlibcVersion(path string) error {
+	required, err := requiredGlibcVersion(path)
+	if err != nil || required == "" {
+		return nil
+	}
+	system, err := systemGlibcVersion()
+	if err != nil {
+		return nil
+	}
+	if compareVersions(required, system) > 0 {
+		return fmt.Errorf("library %s requires glibc >= %s but system has %s", path, required, system)
+	}
+	return nil
+}
+
+// requiredGlibcVersion returns the highest GLIBC_x.y symbol version the ELF file
+// at path imports, or "" if it does not import versioned glibc symbols
+func requiredGlibcVersion(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		return "", err
+	}
+
+	required := ""
+	for _, sym := range syms {
+		version, ok := strings.CutPrefix(sym.Version, "GLIBC_")
+		if !ok || version == "" || version[0] < '0' || version[0] > '9' {
+			// Skips GLIBC_PRIVATE and friends
+			continue
+		}
+		if required == "" || compareVersions(version, required) > 0 {
+			required = version
+		}
+	}
+	return required, nil
+}
+
+// compareVersions compares dotted numeric versions such as 2.35 and 2.4
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(as), len(bs)) {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// NewFromFS creates a Whisper instance from a library stored in fsys, typically an
+// embed.FS, for self-contained binaries. dlopen needs a real file, so the library
+// is extracted to a cache directory named after its SHA-256 (under
+// os.UserCacheDir, or the temp directory) and loaded from there. Later starts
+// reuse the extracted file instead of writing it again.
+func NewFromFS(fsys fs.FS, name string) (*Whisper, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded library %s: %w", name, err)
+	}
+
+	libPath, err := extractLibrary(data, path.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	return New(libPath)
+}
+
+// extractLibrary writes the library to a content addressed cache path, unless it
+// is already there, and returns the path
+func extractLibrary(data []byte, name string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	sum := sha256.Sum256(data)
+	dir := filepath.Join(cacheDir, "gowhisper", hex.EncodeToString(sum[:8]))
+	target := filepath.Join(dir, name)
+
+	if info, err := os.Stat(target); err == nil && info.Size() == int64(len(data)) {
+		return target, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create library cache directory: %w", err)
+	}
+	// Write to a temp file first so concurrent starts never load a partial library
+	tmp, err := os.CreateTemp(dir, name+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to extract library: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to extract library: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to extract library: %w", err)
+	}
+	return target, nil
+}
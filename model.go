@@ -0,0 +1,85 @@
+package whisper
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ggmlMagic is the magic number at the start of whisper.cpp model files ("ggml")
+const ggmlMagic = 0x67676d6c
+
+// modelHParams are the hyperparameters stored in the header of a whisper.cpp model file
+type modelHParams struct {
+	NVocab      int32
+	NAudioCtx   int32
+	NAudioState int32
+	NAudioHead  int32
+	NAudioLayer int32
+	NTextCtx    int32
+	NTextState  int32
+	NTextHead   int32
+	NTextLayer  int32
+	NMels       int32
+	FType       int32
+}
+
+// String summarizes the hyperparameters that tell models apart, in whisper.cpp's names
+func (hp modelHParams) String() string {
+	return fmt.Sprintf("n_vocab=%d n_audio_layer=%d n_text_layer=%d n_mels=%d ftype=%d",
+		hp.NVocab, hp.NAudioLayer, hp.NTextLayer, hp.NMels, hp.FType)
+}
+
+// readModelHParams reads the hyperparameters from the header of a whisper.cpp model file
+func readModelHParams(modelPath string) (modelHParams, error) {
+	var hp modelHParams
+
+	f, err := os.Open(modelPath)
+	if err != nil {
+		return hp, err
+	}
+	defer f.Close()
+
+	var magic uint32
+	if err := binary.Read(f, binary.LittleEndian, &magic); err != nil {
+		return hp, fmt.Errorf("failed to read model header from %s: %w", modelPath, err)
+	}
+	if magic != ggmlMagic {
+		return hp, fmt.Errorf("%s is not a whisper.cpp ggml model (bad magic %#x)", modelPath, magic)
+	}
+	if err := binary.Read(f, binary.LittleEndian, &hp); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return hp, fmt.Errorf("failed to read model header from %s: %w", modelPath, err)
+	}
+	return hp, nil
+}
+
+// EstimateModelMemory returns a conservative upper bound, in bytes, of the memory
+// needed to load and run the model: the weights plus the KV caches and the encoder
+// and decoder working buffers, derived from the hyperparameters in the model header.
+// It is meant for capacity planning before calling Load, not as an exact figure.
+func EstimateModelMemory(modelPath string) (int64, error) {
+	hp, err := readModelHParams(modelPath)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(modelPath)
+	if err != nil {
+		return 0, err
+	}
+
+	const f16, f32 = 2, 4
+	audioCtx, audioState := int64(hp.NAudioCtx), int64(hp.NAudioState)
+	textCtx, textState, textLayer := int64(hp.NTextCtx), int64(hp.NTextState), int64(hp.NTextLayer)
+
+	// Self attention cache, sized for beam search, and cross attention cache (keys and values)
+	kvSelf := 3 * textLayer * textCtx * textState * 2 * f16
+	kvCross := textLayer * audioCtx * textState * 2 * f16
+	// Encoder attention scores and activations, doubled for the graph allocator overhead
+	compute := 2 * (int64(hp.NAudioHead)*audioCtx*audioCtx*f32 + 16*audioCtx*audioState*f32)
+
+	return info.Size() + kvSelf + kvCross + compute, nil
+}
@@ -0,0 +1,56 @@
+package whisper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestModelHeader(t *testing.T, hp modelHParams) string {
+	t.Helper()
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(ggmlMagic))
+	binary.Write(&b, binary.LittleEndian, hp)
+	path := filepath.Join(t.TempDir(), "ggml-test.bin")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEstimateModelMemory(t *testing.T) {
+	// tiny model hyperparameters
+	path := writeTestModelHeader(t, modelHParams{
+		NVocab: 51864, NAudioCtx: 1500, NAudioState: 384, NAudioHead: 6, NAudioLayer: 4,
+		NTextCtx: 448, NTextState: 384, NTextHead: 6, NTextLayer: 4, NMels: 80, FType: 1,
+	})
+
+	estimate, err := EstimateModelMemory(path)
+	if err != nil {
+		t.Fatalf("Failed to estimate memory: %v", err)
+	}
+	if estimate < 100<<20 || estimate > 1<<30 {
+		t.Errorf("Unexpected estimate for tiny model: %d bytes", estimate)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.bin")
+	os.WriteFile(bad, []byte("GGUF...."), 0o644)
+	if _, err := EstimateModelMemory(bad); err == nil {
+		t.Error("Expected error for non-ggml file")
+	}
+}
+
+func TestModelHParamsString(t *testing.T) {
+	turbo := modelHParams{NVocab: 51866, NAudioLayer: 32, NTextLayer: 4, NMels: 128, FType: 1}
+
+	hp, err := readModelHParams(writeTestModelHeader(t, turbo))
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	want := "n_vocab=51866 n_audio_layer=32 n_text_layer=4 n_mels=128 ftype=1"
+	if hp.String() != want {
+		t.Errorf("String() = %q, want %q", hp.String(), want)
+	}
+}
@@ -44,6 +44,9 @@ int load_model(const char *const model_path) {
 
   struct whisper_context_params cparams = whisper_context_default_params();
 
+  if (ctx != nullptr) {
+    whisper_free(ctx);
+  }
   ctx = whisper_init_from_file_with_params(model_path, cparams);
   if (ctx == nullptr) {
     fprintf(stderr, "error: Also failed to init model as transcriber\n");
@@ -63,6 +66,9 @@ int load_model_vad(const char *const model_path) {
   // XXX: Overridden to false in upstream due to performance?
   // vcparams.use_gpu = true;
 
+  if (vctx != nullptr) {
+    whisper_vad_free(vctx);
+  }
   vctx = whisper_vad_init_from_file_with_params(model_path, vcparams);
   if (vctx == nullptr) {
     fprintf(stderr, "error: Failed to init model as VAD\n");
@@ -72,14 +78,39 @@ int load_model_vad(const char *const model_path) {
   return 0;
 }
 
+void free_model() {
+  if (ctx != nullptr) {
+    whisper_free(ctx);
+    ctx = nullptr;
+  }
+  if (vctx != nullptr) {
+    whisper_vad_free(vctx);
+    vctx = nullptr;
+  }
+}
+
 int vad(float pcmf32[], size_t pcmf32_len, float **segs_out,
-        size_t *segs_out_len) {
+        size_t *segs_out_len, float threshold, int min_speech_duration_ms,
+        int min_silence_duration_ms, float max_speech_duration_s,
+        int speech_pad_ms) {
   if (!whisper_vad_detect_speech(vctx, pcmf32, pcmf32_len)) {
     fprintf(stderr, "error: failed to detect speech\n");
     return 1;
   }
 
+  // Zero values keep the whisper.cpp defaults
   struct whisper_vad_params params = whisper_vad_default_params();
+  if (threshold > 0)
+    params.threshold = threshold;
+  if (min_speech_duration_ms > 0)
+    params.min_speech_duration_ms = min_speech_duration_ms;
+  if (min_silence_duration_ms > 0)
+    params.min_silence_duration_ms = min_silence_duration_ms;
+  if (max_speech_duration_s > 0)
+    params.max_speech_duration_s = max_speech_duration_s;
+  if (speech_pad_ms > 0)
+    params.speech_pad_ms = speech_pad_ms;
+
   struct whisper_vad_segments *segs =
       whisper_vad_segments_from_probs(vctx, params);
   size_t segn = whisper_vad_segments_n_segments(segs);
@@ -106,8 +137,31 @@ int vad(float pcmf32[], size_t pcmf32_len, float **segs_out,
   return 0;
 }
 
+struct segment_callback_data {
+  segment_callback cb;
+  uintptr_t user_data;
+  bool aborted;
+};
+
+static void new_segment_cb(struct whisper_context *wctx,
+                           struct whisper_state * /*state*/, int n_new,
+                           void *user_data) {
+  auto *data = (segment_callback_data *)user_data;
+  if (data->aborted)
+    return;
+  int n = whisper_full_n_segments(wctx);
+  if (!data->cb(data->user_data, n - n_new, n_new))
+    data->aborted = true;
+}
+
+static bool abort_cb(void *user_data) {
+  return ((segment_callback_data *)user_data)->aborted;
+}
+
 int transcribe(uint32_t threads, char *lang, bool translate, bool tdrz,
-               float pcmf32[], size_t pcmf32_len, size_t *segs_out_len, char *prompt) {
+               float pcmf32[], size_t pcmf32_len, size_t *segs_out_len, char *prompt,
+               bool no_timestamps, bool token_timestamps, int n_processors,
+               segment_callback on_segments, uintptr_t user_data) {
   whisper_full_params wparams =
       whisper_full_default_params(WHISPER_SAMPLING_GREEDY);
 
@@ -123,11 +177,33 @@ int transcribe(uint32_t threads, char *lang, bool translate, bool tdrz,
   wparams.print_progress = true;
   wparams.tdrz_enable = tdrz;
   wparams.initial_prompt = prompt;
+  wparams.no_timestamps = no_timestamps;
+  wparams.token_timestamps = token_timestamps;
+
+  // Report segments as they are decoded. whisper_full_parallel does not call
+  // these, the caller collects the remaining segments after it returns.
+  segment_callback_data cb_data = {on_segments, user_data, false};
+  if (on_segments != nullptr) {
+    wparams.new_segment_callback = new_segment_cb;
+    wparams.new_segment_callback_user_data = &cb_data;
+    wparams.abort_callback = abort_cb;
+    wparams.abort_callback_user_data = &cb_data;
+  }
 
   fprintf(stderr, "info: Enable tdrz: %d\n", tdrz);
   fprintf(stderr, "info: Initial prompt: \"%s\"\n", prompt);
 
-  if (whisper_full(ctx, wparams, pcmf32, pcmf32_len)) {
+  int ret;
+  if (n_processors > 1)
+    ret = whisper_full_parallel(ctx, wparams, pcmf32, pcmf32_len, n_processors);
+  else
+    ret = whisper_full(ctx, wparams, pcmf32, pcmf32_len);
+
+  // Stopped by the callback, the segments decoded so far are kept
+  if (ret && cb_data.aborted)
+    ret = 0;
+
+  if (ret) {
     fprintf(stderr, "error: transcription failed\n");
     return 1;
   }
@@ -151,6 +227,69 @@ int32_t get_token_id(int i, int j) {
   return whisper_full_get_token_id(ctx, i, j);
 }
 
+float get_token_p(int i, int j) { return whisper_full_get_token_p(ctx, i, j); }
+
+const char *get_token_text(int i, int j) {
+  return whisper_full_get_token_text(ctx, i, j);
+}
+
+int64_t get_token_t0(int i, int j) {
+  return whisper_full_get_token_data(ctx, i, j).t0;
+}
+
+int64_t get_token_t1(int i, int j) {
+  return whisper_full_get_token_data(ctx, i, j).t1;
+}
+
 bool get_segment_speaker_turn_next(int i) {
   return whisper_full_get_segment_speaker_turn_next(ctx, i);
 }
+
+bool is_multilingual() { return whisper_is_multilingual(ctx) != 0; }
+
+int n_vocab() { return whisper_n_vocab(ctx); }
+
+int token_eot() { return whisper_token_eot(ctx); }
+
+int token_sot() { return whisper_token_sot(ctx); }
+
+int token_translate() { return whisper_token_translate(ctx); }
+
+int token_transcribe() { return whisper_token_transcribe(ctx); }
+
+int token_beg() { return whisper_token_beg(ctx); }
+
+const char *model_type() { return whisper_model_type_readable(ctx); }
+
+int model_n_audio_ctx() { return whisper_model_n_audio_ctx(ctx); }
+
+int model_n_audio_layer() { return whisper_model_n_audio_layer(ctx); }
+
+int model_n_text_ctx() { return whisper_model_n_text_ctx(ctx); }
+
+int model_n_text_layer() { return whisper_model_n_text_layer(ctx); }
+
+int model_n_mels() { return whisper_model_n_mels(ctx); }
+
+int lang_max_id() { return whisper_lang_max_id(); }
+
+const char *lang_str(int id) {
+  const char *lang = whisper_lang_str(id);
+  return lang ? lang : "";
+}
+
+int detect_language(float pcmf32[], size_t pcmf32_len, uint32_t threads,
+                    float *lang_probs) {
+  if (whisper_pcm_to_mel(ctx, pcmf32, pcmf32_len, threads)) {
+    fprintf(stderr, "error: failed to compute mel spectrogram\n");
+    return -1;
+  }
+
+  // Returns the most probable language id, or a negative value on failure
+  return whisper_lang_auto_detect(ctx, 0, threads, lang_probs);
+}
+
+const char *full_lang() {
+  const char *lang = whisper_lang_str(whisper_full_lang_id(ctx));
+  return lang ? lang : "";
+}
@@ -18,17 +18,48 @@
 extern "C" {
 GOWHISPER_API int load_model(const char *const model_path);
 GOWHISPER_API int load_model_vad(const char *const model_path);
+GOWHISPER_API void free_model();
 GOWHISPER_API int vad(float pcmf32[], size_t pcmf32_size, float **segs_out,
-        size_t *segs_out_len);
+        size_t *segs_out_len, float threshold, int min_speech_duration_ms,
+        int min_silence_duration_ms, float max_speech_duration_s,
+        int speech_pad_ms);
+// segment_callback receives the new segments [first, first+n) of a running
+// transcription; returning 0 aborts it
+typedef uintptr_t (*segment_callback)(uintptr_t user_data, uintptr_t first,
+                                      uintptr_t n);
 GOWHISPER_API int transcribe(uint32_t threads, char *lang, bool translate, bool tdrz,
                float pcmf32[], size_t pcmf32_len, size_t *segs_out_len,
-               char *prompt);
+               char *prompt, bool no_timestamps, bool token_timestamps,
+               int n_processors, segment_callback on_segments,
+               uintptr_t user_data);
 GOWHISPER_API const char *get_segment_text(int i);
 GOWHISPER_API int64_t get_segment_t0(int i);
 GOWHISPER_API int64_t get_segment_t1(int i);
 GOWHISPER_API int n_tokens(int i);
 GOWHISPER_API int32_t get_token_id(int i, int j);
+GOWHISPER_API float get_token_p(int i, int j);
+GOWHISPER_API const char *get_token_text(int i, int j);
+GOWHISPER_API int64_t get_token_t0(int i, int j);
+GOWHISPER_API int64_t get_token_t1(int i, int j);
 GOWHISPER_API bool get_segment_speaker_turn_next(int i);
+GOWHISPER_API bool is_multilingual();
+GOWHISPER_API int n_vocab();
+GOWHISPER_API int token_eot();
+GOWHISPER_API int token_sot();
+GOWHISPER_API int token_translate();
+GOWHISPER_API int token_transcribe();
+GOWHISPER_API int token_beg();
+GOWHISPER_API const char *model_type();
+GOWHISPER_API int model_n_audio_ctx();
+GOWHISPER_API int model_n_audio_layer();
+GOWHISPER_API int model_n_text_ctx();
+GOWHISPER_API int model_n_text_layer();
+GOWHISPER_API int model_n_mels();
+GOWHISPER_API int lang_max_id();
+GOWHISPER_API const char *lang_str(int id);
+GOWHISPER_API int detect_language(float pcmf32[], size_t pcmf32_len,
+                                  uint32_t threads, float *lang_probs);
+GOWHISPER_API const char *full_lang();
 }
 
 #endif // GOWHISPER_H
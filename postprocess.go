@@ -0,0 +1,344 @@
+package whisper
+
+import (
+	"bytes"
+	"compress/zlib"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// dedupeMinOverlap is the fraction of the shorter segment that must overlap
+	// in time with its neighbour for the pair to be considered duplicates
+	dedupeMinOverlap = 0.5
+	// dedupeMinSimilarity is the minimum normalized text similarity (1 - edit distance / length)
+	// for two overlapping segments to be considered duplicates
+	dedupeMinSimilarity = 0.8
+)
+
+// deduplicateSegments removes segments that whisper emitted twice across window
+// boundaries. Two consecutive segments are duplicates when at least half of the
+// shorter one overlaps the other in time and their texts are at least 80% similar.
+// The segment with the higher Probability is kept.
+func deduplicateSegments(segments []*Segment) []*Segment {
+	result := make([]*Segment, 0, len(segments))
+	for _, seg := range segments {
+		if len(result) == 0 {
+			result = append(result, seg)
+			continue
+		}
+		prev := result[len(result)-1]
+		if !overlaps(prev, seg) || textSimilarity(prev.Text, seg.Text) < dedupeMinSimilarity {
+			result = append(result, seg)
+			continue
+		}
+		if seg.Probability > prev.Probability {
+			result[len(result)-1] = seg
+		}
+	}
+	return result
+}
+
+// overlaps reports whether a and b overlap by at least dedupeMinOverlap of the shorter segment
+func overlaps(a, b *Segment) bool {
+	overlap := min(a.End, b.End) - max(a.Start, b.Start)
+	if overlap <= 0 {
+		return false
+	}
+	shorter := min(a.End-a.Start, b.End-b.Start)
+	if shorter <= 0 {
+		return true
+	}
+	return float64(overlap)/float64(shorter) >= dedupeMinOverlap
+}
+
+// textSimilarity returns a similarity between 0 and 1 of the normalized texts
+func textSimilarity(a, b string) float64 {
+	ra, rb := []rune(normalizeText(a)), []rune(normalizeText(b))
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// normalizeText lowercases the text and strips punctuation and extra whitespace
+func normalizeText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein[T comparable](a, b []T) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// WordCount returns the number of words in the segment text. Characters of scripts
+// written without spaces (Chinese, Japanese, Thai, ...) count as one word each,
+// since those texts cannot be split on whitespace.
+func (s *Segment) WordCount() int {
+	count := 0
+	inWord := false
+	for _, r := range s.Text {
+		switch {
+		case unicode.In(r, unspacedScripts...):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if !inWord {
+				count++
+			}
+			inWord = true
+		case unicode.IsSpace(r):
+			inWord = false
+		}
+	}
+	return count
+}
+
+// CharCount returns the number of characters (runes) in the segment text, not counting whitespace
+func (s *Segment) CharCount() int {
+	count := 0
+	for _, r := range s.Text {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// SpeakingRate returns the words per minute of the segment, or 0 if it has no duration
+func (s *Segment) SpeakingRate() float64 {
+	return wordsPerMinute(s.WordCount(), time.Duration(s.End-s.Start))
+}
+
+// SpeakingRate returns the overall words per minute: the words of all segments
+// over the audio Duration, including pauses. Results without a Duration use the
+// end of the last segment; 0 is returned if neither is known.
+func (r TranscriptionResult) SpeakingRate() float64 {
+	words := 0
+	for _, seg := range r.Segments {
+		words += seg.WordCount()
+	}
+	d := r.Duration
+	if d <= 0 && len(r.Segments) > 0 {
+		d = time.Duration(r.Segments[len(r.Segments)-1].End)
+	}
+	return wordsPerMinute(words, d)
+}
+
+// wordsPerMinute returns words / d in minutes, or 0 for a non-positive duration
+func wordsPerMinute(words int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(words) / d.Minutes()
+}
+
+// MergeSegments returns a copy of the result where consecutive segments are merged
+// when the gap between them is shorter than maxGapMs or either of them lasts less
+// than minDurationMs. Merged segments span both timestamps and concatenate text
+// and tokens. Segments of different speakers are never merged.
+func (r TranscriptionResult) MergeSegments(maxGapMs, minDurationMs int) TranscriptionResult {
+	maxGap := int64(time.Duration(maxGapMs) * time.Millisecond)
+	minDuration := int64(time.Duration(minDurationMs) * time.Millisecond)
+
+	segments := make([]*Segment, 0, len(r.Segments))
+	for _, seg := range r.Segments {
+		if len(segments) > 0 {
+			prev := segments[len(segments)-1]
+			short := prev.End-prev.Start < minDuration || seg.End-seg.Start < minDuration
+			if prev.Speaker == seg.Speaker && (seg.Start-prev.End < maxGap || short) {
+				mergeSegment(prev, seg)
+				continue
+			}
+		}
+		merged := *seg
+		merged.Id = int32(len(segments))
+		merged.Tokens = slices.Clone(seg.Tokens)
+		merged.Words = slices.Clone(seg.Words)
+		segments = append(segments, &merged)
+	}
+
+	return TranscriptionResult{Segments: segments, Text: r.Text, Duration: r.Duration}
+}
+
+// mergeSegment appends next to seg, weighting the probability by token count
+func mergeSegment(seg, next *Segment) {
+	if n := len(seg.Tokens) + len(next.Tokens); n > 0 {
+		seg.Probability = (seg.Probability*float32(len(seg.Tokens)) + next.Probability*float32(len(next.Tokens))) / float32(n)
+	}
+	seg.Text += next.Text
+	seg.End = max(seg.End, next.End)
+	seg.Tokens = append(seg.Tokens, next.Tokens...)
+	seg.Words = append(seg.Words, next.Words...)
+}
+
+// filterCompressionRatio drops segments whose text compresses better than maxRatio.
+// Repetition loops such as "you you you you" compress extremely well.
+func filterCompressionRatio(segments []*Segment, maxRatio float32) []*Segment {
+	return slices.DeleteFunc(segments, func(seg *Segment) bool {
+		return compressionRatio(seg.Text) > maxRatio
+	})
+}
+
+// compressionRatio returns the length of the text divided by the length of its
+// zlib compressed form, the measure OpenAI's whisper uses to detect repetition
+func compressionRatio(text string) float32 {
+	if text == "" {
+		return 0
+	}
+	var b bytes.Buffer
+	// Go's default level skips matching on short inputs, unlike Python's zlib
+	zw, _ := zlib.NewWriterLevel(&b, zlib.BestCompression)
+	zw.Write([]byte(text))
+	zw.Close()
+	return float32(len(text)) / float32(b.Len())
+}
+
+// splitWords splits the normalized text into words. Characters of scripts
+// written without spaces are returned as separate words.
+func splitWords(text string) []string {
+	return tokenizeWords(normalizeText(text))
+}
+
+// tokenizeWords splits text into words on whitespace, returning characters of
+// scripts written without spaces as separate words
+func tokenizeWords(text string) []string {
+	words := []string{}
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.In(r, unspacedScripts...):
+			flush()
+			words = append(words, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// sentenceEnds are the punctuation marks that end a sentence. '.', '!' and '?'
+// only end a sentence when followed by a space, so "3.5" and "e.g.x" are kept
+// together; the CJK, Devanagari and Arabic marks always end one.
+const (
+	spacedSentenceEnds   = ".!?…"
+	unspacedSentenceEnds = "。！？।؟"
+)
+
+// sentenceClosers may follow the end of a sentence and belong to it
+const sentenceClosers = `"')]»”’」』`
+
+// SplitBySentence returns a copy of the result re-segmented at sentence
+// boundaries instead of whisper's windows. The text of all segments is
+// concatenated and split after sentence punctuation; the times of each sentence
+// are interpolated from the character positions within the original segments.
+// Sentence text is trimmed of surrounding whitespace. Speaker, Language and
+// Probability are those of the segment a sentence starts in, Words are
+// assigned by start time and Tokens are not carried over.
+func (r TranscriptionResult) SplitBySentence() TranscriptionResult {
+	// Start and end time of every rune of the concatenated text
+	var text []rune
+	var starts, ends []int64
+	var owners []*Segment
+	for _, seg := range r.Segments {
+		runes := []rune(seg.Text)
+		dur := seg.End - seg.Start
+		for i, c := range runes {
+			text = append(text, c)
+			starts = append(starts, seg.Start+dur*int64(i)/int64(len(runes)))
+			ends = append(ends, seg.Start+dur*int64(i+1)/int64(len(runes)))
+			owners = append(owners, seg)
+		}
+	}
+
+	segments := []*Segment{}
+	emit := func(from, to int) {
+		for from < to && unicode.IsSpace(text[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(text[to-1]) {
+			to--
+		}
+		if from == to {
+			return
+		}
+		owner := owners[from]
+		segments = append(segments, &Segment{
+			Id:          int32(len(segments)),
+			Text:        string(text[from:to]),
+			Start:       starts[from],
+			End:         ends[to-1],
+			Speaker:     owner.Speaker,
+			Probability: owner.Probability,
+			Language:    owner.Language,
+		})
+	}
+
+	from := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		unspaced := strings.ContainsRune(unspacedSentenceEnds, c)
+		if !unspaced && !strings.ContainsRune(spacedSentenceEnds, c) {
+			continue
+		}
+		end := i + 1
+		for end < len(text) && (strings.ContainsRune(spacedSentenceEnds+unspacedSentenceEnds, text[end]) ||
+			strings.ContainsRune(sentenceClosers, text[end])) {
+			end++
+		}
+		if unspaced || end == len(text) || unicode.IsSpace(text[end]) {
+			emit(from, end)
+			from = end
+		}
+		i = end - 1
+	}
+	emit(from, len(text))
+
+	for _, seg := range r.Segments {
+		for _, word := range seg.Words {
+			i := len(segments) - 1
+			for i > 0 && segments[i].Start > word.Start {
+				i--
+			}
+			if i >= 0 {
+				segments[i].Words = append(segments[i].Words, word)
+			}
+		}
+	}
+
+	return TranscriptionResult{Segments: segments, Text: r.Text, Duration: r.Duration}
+}
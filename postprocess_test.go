@@ -0,0 +1,160 @@
+package whisper
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeduplicateSegments(t *testing.T) {
+	sec := int64(time.Second)
+	segments := []*Segment{
+		{Id: 0, Text: " And so my fellow Americans", Start: 0, End: 3 * sec, Probability: 0.6},
+		{Id: 1, Text: " and so my fellow Americans,", Start: 1 * sec, End: 3 * sec, Probability: 0.9},
+		{Id: 2, Text: " ask not what your country can do for you", Start: 3 * sec, End: 6 * sec, Probability: 0.8},
+	}
+
+	result := deduplicateSegments(segments)
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(result))
+	}
+	if result[0].Id != 1 {
+		t.Errorf("Expected higher probability duplicate to be kept, got segment %d", result[0].Id)
+	}
+	if text := segmentsText(result, " "); text != "and so my fellow Americans, ask not what your country can do for you" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestSegmentCounts(t *testing.T) {
+	tests := []struct {
+		text  string
+		words int
+		chars int
+	}{
+		{" And so, my fellow Americans", 5, 23},
+		{" it's 2 o'clock", 3, 12},
+		{"今天天气很好", 6, 6},
+		{" Hello 世界", 3, 7},
+		{"", 0, 0},
+	}
+	for _, tt := range tests {
+		s := &Segment{Text: tt.text}
+		if got := s.WordCount(); got != tt.words {
+			t.Errorf("WordCount(%q) = %d, want %d", tt.text, got, tt.words)
+		}
+		if got := s.CharCount(); got != tt.chars {
+			t.Errorf("CharCount(%q) = %d, want %d", tt.text, got, tt.chars)
+		}
+	}
+}
+
+func TestMergeSegments(t *testing.T) {
+	ms := int64(time.Millisecond)
+	result := TranscriptionResult{
+		Segments: []*Segment{
+			{Id: 0, Text: " And so", Start: 0, End: 800 * ms, Tokens: []int32{1, 2}, Probability: 0.5},
+			{Id: 1, Text: " my fellow", Start: 850 * ms, End: 2000 * ms, Tokens: []int32{3, 4}, Probability: 1},
+			{Id: 2, Text: " Americans,", Start: 3000 * ms, End: 3200 * ms, Tokens: []int32{5}, Probability: 1},
+			{Id: 3, Text: " ask not", Start: 5000 * ms, End: 7000 * ms, Tokens: []int32{6, 7}, Probability: 1},
+		},
+		Text: "And so my fellow Americans, ask not",
+	}
+
+	merged := result.MergeSegments(100, 300)
+	if len(merged.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(merged.Segments))
+	}
+	first := merged.Segments[0]
+	if first.Text != " And so my fellow Americans," || first.Start != 0 || first.End != 3200*ms {
+		t.Errorf("Unexpected merged segment %+v", first)
+	}
+	if len(first.Tokens) != 5 || first.Probability != 0.8 {
+		t.Errorf("Unexpected merged tokens %v or probability %v", first.Tokens, first.Probability)
+	}
+	if merged.Segments[1].Id != 1 {
+		t.Errorf("Expected segments to be renumbered, got id %d", merged.Segments[1].Id)
+	}
+	if result.Segments[0].Text != " And so" || len(result.Segments[0].Tokens) != 2 {
+		t.Error("Expected the original result to be left untouched")
+	}
+}
+
+func TestFilterCompressionRatio(t *testing.T) {
+	segments := []*Segment{
+		{Id: 0, Text: " And so my fellow Americans, ask not what your country can do for you"},
+		{Id: 1, Text: strings.Repeat(" you", 30)},
+		{Id: 2, Text: " ask what you can do for your country."},
+	}
+
+	result := filterCompressionRatio(segments, 2.4)
+	if len(result) != 2 || result[0].Id != 0 || result[1].Id != 2 {
+		t.Errorf("Expected the repetition loop to be dropped, got %d segments", len(result))
+	}
+}
+
+func TestSplitBySentence(t *testing.T) {
+	ms := int64(time.Millisecond)
+	// 100ms per character
+	res := TranscriptionResult{Text: "Hi there. How are you? Pi 3.5好。谢谢！", Segments: []*Segment{
+		{Text: " Hi there.", Start: 0, End: 1000 * ms, Speaker: "A"},
+		{Text: " How are y", Start: 1000 * ms, End: 2000 * ms, Speaker: "B",
+			Words: []Word{{Text: "How", Start: 1100 * ms, End: 1400 * ms}}},
+		{Text: "ou? Pi 3.5", Start: 2000 * ms, End: 3000 * ms, Speaker: "B"},
+		{Text: "好。谢谢！", Start: 3000 * ms, End: 3500 * ms, Speaker: "B"},
+	}}
+
+	split := res.SplitBySentence()
+	want := []struct {
+		text       string
+		start, end int64
+		speaker    string
+	}{
+		{"Hi there.", 100 * ms, 1000 * ms, "A"},
+		{"How are you?", 1100 * ms, 2300 * ms, "B"},
+		{"Pi 3.5好。", 2400 * ms, 3200 * ms, "B"},
+		{"谢谢！", 3200 * ms, 3500 * ms, "B"},
+	}
+	if len(split.Segments) != len(want) {
+		t.Fatalf("Expected %d sentences, got %d", len(want), len(split.Segments))
+	}
+	for i, w := range want {
+		seg := split.Segments[i]
+		if seg.Id != int32(i) || seg.Text != w.text || seg.Start != w.start || seg.End != w.end || seg.Speaker != w.speaker {
+			t.Errorf("Sentence %d = %d %q [%d, %d] %s, want %q [%d, %d] %s", i,
+				seg.Id, seg.Text, seg.Start, seg.End, seg.Speaker, w.text, w.start, w.end, w.speaker)
+		}
+	}
+	if len(split.Segments[1].Words) != 1 {
+		t.Errorf("Expected the word to move to the second sentence, got %+v", split.Segments[1].Words)
+	}
+	if split.Text != res.Text {
+		t.Errorf("Expected the text to be unchanged, got %q", split.Text)
+	}
+}
+
+func TestSpeakingRate(t *testing.T) {
+	sec := int64(time.Second)
+	res := TranscriptionResult{Duration: 30 * time.Second, Segments: []*Segment{
+		{Text: " And so my fellow Americans", Start: 0, End: 2 * sec},
+		{Text: " ask not", Start: 10 * sec, End: 11 * sec},
+	}}
+	if got := res.SpeakingRate(); got != 14 {
+		t.Errorf("Expected 7 words in 30s to be 14 wpm, got %v", got)
+	}
+	if got := res.Segments[0].SpeakingRate(); got != 150 {
+		t.Errorf("Expected 5 words in 2s to be 150 wpm, got %v", got)
+	}
+
+	res.Duration = 0
+	if got := res.SpeakingRate(); math.Abs(got-7.0/11*60) > 1e-9 {
+		t.Errorf("Expected the last segment end to be used without Duration, got %v", got)
+	}
+	if got := (TranscriptionResult{}).SpeakingRate(); got != 0 {
+		t.Errorf("Expected 0 for an empty result, got %v", got)
+	}
+	if got := (&Segment{Text: " hi"}).SpeakingRate(); got != 0 {
+		t.Errorf("Expected 0 for a zero-length segment, got %v", got)
+	}
+}
@@ -0,0 +1,388 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowSamples is the length of the 30 second window whisper decodes at once
+const windowSamples = 30 * SampleRate
+
+// readerWaitDelay is how long TranscribeReader waits for the copy of its reader
+// to ffmpeg after ffmpeg exits
+const readerWaitDelay = time.Second
+
+// segmentEvent is the JSON object written per segment by TranscribeStreamJSON
+type segmentEvent struct {
+	ID    int32   `json:"id"`
+	Start float64 `json:"start"` // seconds
+	End   float64 `json:"end"`   // seconds
+	Text  string  `json:"text"`
+}
+
+// TranscribeStreamJSON transcribes the audio file and writes newline-delimited JSON,
+// one object per segment with id, start, end (in seconds) and text.
+// Each line is written and flushed as soon as the native library decodes the
+// segment, so the output can be followed with tools like tail -f. With
+// Processors > 1 whisper.cpp only reports segments at the end.
+func (w *Whisper) TranscribeStreamJSON(audioFile string, opts TranscriptionOptions, out io.Writer) error {
+	return w.TranscribeTo(audioFile, opts, out, FormatJSONL)
+}
+
+// Format is an output format of TranscribeTo
+type Format string
+
+const (
+	// FormatSRT writes SubRip subtitles
+	FormatSRT Format = "srt"
+	// FormatVTT writes WebVTT subtitles
+	FormatVTT Format = "vtt"
+	// FormatJSONL writes one JSON object per line, see TranscribeStreamJSON
+	FormatJSONL Format = "jsonl"
+	// FormatText writes the text of every segment on its own line
+	FormatText Format = "txt"
+)
+
+// TranscribeTo transcribes the audio file and writes the segments to out in the
+// given format, each as soon as it is decoded, flushing writers that support it.
+// MaxCompressionRatio drops segments before they are written. DeduplicateSegments
+// holds every segment back until the next one shows it is not a repeat, so output
+// lags by one segment. Checkpoint and ChannelSpeakerNames are not supported.
+func (w *Whisper) TranscribeTo(audioFile string, opts TranscriptionOptions, out io.Writer, format Format) error {
+	if !slices.Contains([]Format{FormatSRT, FormatVTT, FormatJSONL, FormatText}, format) {
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	if opts.Checkpoint != "" {
+		return errors.New("TranscribeTo does not support Checkpoint, use Transcribe")
+	}
+	if len(opts.ChannelSpeakerNames) > 0 {
+		return errors.New("TranscribeTo does not support ChannelSpeakerNames, use Transcribe")
+	}
+
+	data, err := readAudioFile(audioFile, opts.conversion())
+	if err != nil {
+		return err
+	}
+
+	if format == FormatVTT {
+		if _, err := io.WriteString(out, "WEBVTT\n\n"); err != nil {
+			return err
+		}
+	}
+
+	n := 0
+	write := func(seg *Segment) error {
+		n++
+		if err := writeSegment(out, format, n, seg); err != nil {
+			return err
+		}
+		return flushWriter(out)
+	}
+
+	// pending is the last segment, held back while DeduplicateSegments may still replace it
+	var pending *Segment
+	_, err = w.transcribe(data, opts, func(seg *Segment) error {
+		if opts.MaxCompressionRatio > 0 && compressionRatio(seg.Text) > opts.MaxCompressionRatio {
+			return nil
+		}
+		if !opts.DeduplicateSegments {
+			return write(seg)
+		}
+		if pending == nil {
+			pending = seg
+			return nil
+		}
+		kept := deduplicateSegments([]*Segment{pending, seg})
+		if len(kept) == 2 {
+			if err := write(pending); err != nil {
+				return err
+			}
+		}
+		pending = kept[len(kept)-1]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		return write(pending)
+	}
+	return nil
+}
+
+// writeSegment writes the segment in the given format, n is its 1-based cue number
+func writeSegment(out io.Writer, format Format, n int, seg *Segment) error {
+	text := strings.TrimSpace(seg.Text)
+	var err error
+	switch format {
+	case FormatSRT:
+		_, err = fmt.Fprintf(out, "%d\n%s --> %s\n%s\n\n", n, FormatTimestamp(seg.Start, ','), FormatTimestamp(seg.End, ','), text)
+	case FormatVTT:
+		_, err = fmt.Fprintf(out, "%s --> %s\n%s\n\n", FormatTimestamp(seg.Start, '.'), FormatTimestamp(seg.End, '.'), text)
+	case FormatJSONL:
+		err = json.NewEncoder(out).Encode(segmentEvent{
+			ID:    seg.Id,
+			Start: time.Duration(seg.Start).Seconds(),
+			End:   time.Duration(seg.End).Seconds(),
+			Text:  seg.Text,
+		})
+	case FormatText:
+		_, err = fmt.Fprintln(out, text)
+	}
+	return err
+}
+
+// flushWriter flushes out if it buffers its writes
+func flushWriter(out io.Writer) error {
+	switch f := out.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case http.Flusher:
+		f.Flush()
+	}
+	return nil
+}
+
+// TranscribeReader transcribes audio read from r, for example an Opus or AAC stream
+// from a WebRTC pipeline, without intermediate files. format is the ffmpeg demuxer
+// of the stream, such as "ogg" (Opus), "webm", "aac" (ADTS) or "mp3"; leave it
+// empty to let ffmpeg probe the input.
+//
+// whisper decodes 30 second windows, so at least 30 seconds of audio are buffered
+// before the first segments are produced; each window is transcribed as soon as it
+// is complete and its segments are passed to opts.OnSegment. When the stream ends
+// mid-window the remainder is padded with silence to a full window.
+//
+// Returning early, on an error or when OnSegment returns false, does not wait for
+// a blocked r: the goroutine copying r to ffmpeg stays in Read until it returns,
+// so close r to release it.
+func (w *Whisper) TranscribeReader(r io.Reader, format string, opts TranscriptionOptions) (TranscriptionResult, error) {
+	if err := validateFFmpegArgs(opts.FFmpegArgs); err != nil {
+		return TranscriptionResult{}, err
+	}
+
+	args := []string{}
+	if format != "" {
+		args = append(args, "-f", format)
+	}
+	args = append(args, "-i", "pipe:0")
+	args = append(args, opts.FFmpegArgs...)
+	args = append(args, "-f", "s16le", "-ar", strconv.Itoa(SampleRate), "-ac", "1", "pipe:1")
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdin = r
+	// Wait would otherwise block until r returns from Read, forever for a stalled stream
+	cmd.WaitDelay = readerWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return TranscriptionResult{}, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	onSegment := opts.OnSegment
+	windowOpts := opts
+	windowOpts.OnSegment = nil
+	// The limit applies to the whole stream, not to the padded windows
+	windowOpts.MaxDurationSec = 0
+
+	segments := []*Segment{}
+	pcm := make([]byte, windowSamples*2)
+	offset, total := 0, 0
+	stopped := false
+	for !stopped {
+		n, readErr := io.ReadFull(stdout, pcm)
+		if n == 0 {
+			break
+		}
+		total += n / 2
+		if err := opts.checkDuration(total); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return TranscriptionResult{Duration: samplesDuration(total)}, err
+		}
+
+		// Pad a partial last window with silence
+		clear(pcm[n:])
+
+		res, err := w.transcribe(pcm16ToFloat32(pcm), windowOpts, nil)
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return TranscriptionResult{}, err
+		}
+		shiftSegments(res.Segments, offset, len(segments))
+		for _, seg := range res.Segments {
+			segments = append(segments, seg)
+			if onSegment != nil && !onSegment(seg) {
+				stopped = true
+				break
+			}
+		}
+		offset += windowSamples
+
+		if readErr != nil {
+			if !errors.Is(readErr, io.ErrUnexpectedEOF) && !errors.Is(readErr, io.EOF) {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return TranscriptionResult{}, readErr
+			}
+			break
+		}
+	}
+
+	if stopped {
+		cmd.Process.Kill()
+		cmd.Wait()
+	} else if err := cmd.Wait(); err != nil {
+		return TranscriptionResult{}, fmt.Errorf("ffmpeg failed: %s: %s", err, stderr.String())
+	}
+
+	if opts.DeduplicateSegments {
+		segments = deduplicateSegments(segments)
+	}
+	return TranscriptionResult{
+		Segments: segments,
+		Text:     segmentsText(segments, textJoiner(opts.TextJoiner, opts.Language, segments)),
+		Duration: samplesDuration(total),
+	}, nil
+}
+
+// SegmentStream is the output of TranscribeChannel
+type SegmentStream struct {
+	// C receives the segments and is closed when the stream ends
+	C   <-chan *Segment
+	err error
+}
+
+// Err returns why the stream ended. It must only be called after C is closed and
+// is nil if the input was flushed, ctx.Err() if ctx was cancelled, or the error
+// that stopped the transcription, such as ErrAudioTooLong.
+func (s *SegmentStream) Err() error {
+	return s.err
+}
+
+// TranscribeChannel transcribes live 16kHz mono audio, such as microphone capture,
+// received as chunks of any size on samples. Segments are sent on the returned
+// stream as each window is transcribed.
+//
+// Audio is buffered into 30 second windows. If a VAD model is loaded, a window is
+// cut before a speech segment that is still running at its end, and that speech
+// is carried over into the next window. Without a VAD model the windows are cut
+// at fixed boundaries, which can split words. Closing samples flushes the buffered
+// audio. The stream ends once the audio is flushed, ctx is cancelled, a
+// transcription fails or more audio than MaxDurationSec arrives in total; Err
+// tells these apart.
+func (w *Whisper) TranscribeChannel(ctx context.Context, samples <-chan []float32, opts TranscriptionOptions) (*SegmentStream, error) {
+	w.lock()
+	loaded := w.state.modelLoaded
+	w.unlock()
+	if !loaded {
+		return nil, ErrModelNotLoaded
+	}
+
+	windowOpts := opts
+	windowOpts.OnSegment = nil
+	// The limit applies to the whole stream, not to the windows
+	windowOpts.MaxDurationSec = 0
+
+	out := make(chan *Segment)
+	stream := &SegmentStream{C: out}
+	go func() {
+		// Set before closing C, so Err sees it after C is drained
+		stream.err = w.streamWindows(ctx, samples, opts, windowOpts, out)
+		close(out)
+	}()
+	return stream, nil
+}
+
+// streamWindows runs TranscribeChannel, transcribing the windows of samples with
+// windowOpts and sending their segments to out
+func (w *Whisper) streamWindows(ctx context.Context, samples <-chan []float32, opts, windowOpts TranscriptionOptions, out chan<- *Segment) error {
+	var buf []float32
+	offset, nextID, total := 0, 0, 0
+
+	// emit transcribes the first n buffered samples and sends their segments
+	emit := func(n int) error {
+		res, err := w.transcribe(buf[:n], windowOpts, nil)
+		if err != nil {
+			return err
+		}
+		shiftSegments(res.Segments, offset, nextID)
+		nextID += len(res.Segments)
+		for _, seg := range res.Segments {
+			select {
+			case out <- seg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		buf = slices.Delete(buf, 0, n)
+		offset += n
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chunk, ok := <-samples:
+			if !ok {
+				if len(buf) > 0 {
+					return emit(len(buf))
+				}
+				return nil
+			}
+			total += len(chunk)
+			if err := opts.checkDuration(total); err != nil {
+				return err
+			}
+			buf = append(buf, chunk...)
+			for len(buf) >= windowSamples {
+				cut, err := w.windowCut(buf[:windowSamples])
+				if err != nil {
+					return err
+				}
+				if err := emit(cut); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// windowCut returns where to cut a full window so that speech running into its
+// end is left for the next window. It cuts the whole window when no VAD model is
+// loaded or the speech fills the window entirely.
+func (w *Whisper) windowCut(window []float32) (int, error) {
+	segments, err := w.vad(window, VADOptions{})
+	if errors.Is(err, ErrVADModelNotLoaded) {
+		return len(window), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(segments) == 0 {
+		return len(window), nil
+	}
+
+	last := segments[len(segments)-1]
+	start, end := last.SampleRange(SampleRate, len(window))
+	if end+int(vadMergeGap*SampleRate) < len(window) || start == 0 {
+		return len(window), nil
+	}
+	return start, nil
+}
@@ -0,0 +1,269 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+func TestTranscribeToUnsupportedOptions(t *testing.T) {
+	w := &Whisper{state: &nativeState{}}
+
+	for _, opts := range []TranscriptionOptions{
+		{Checkpoint: "progress.json"},
+		{ChannelSpeakerNames: []string{"left", "right"}},
+	} {
+		if err := w.TranscribeTo("test/data/jfk.wav", opts, io.Discard, FormatText); err == nil {
+			t.Errorf("Expected TranscribeTo to reject %+v", opts)
+		}
+	}
+}
+
+func skipIfNoFFmpeg(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("Skipping test: ffmpeg not found")
+	}
+}
+
+// stalledReader returns the data of r and then blocks until done is closed,
+// like a live stream that stops sending
+type stalledReader struct {
+	r    io.Reader
+	done chan struct{}
+}
+
+func (s stalledReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		<-s.done
+	}
+	return n, err
+}
+
+func newStalledReader(t *testing.T, path string) io.Reader {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	return stalledReader{bytes.NewReader(data), done}
+}
+
+// transcribeReaderWithin runs TranscribeReader and fails the test if it does not return in time
+func transcribeReaderWithin(t *testing.T, w *Whisper, r io.Reader, opts TranscriptionOptions) error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.TranscribeReader(r, "wav", opts)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(30 * time.Second):
+		t.Fatal("TranscribeReader did not return with a stalled reader")
+		return nil
+	}
+}
+
+func TestTranscribeReaderStalledError(t *testing.T) {
+	skipIfNoFFmpeg(t)
+
+	// A full window is decoded, then the transcription fails while r blocks
+	w := &Whisper{state: &nativeState{}}
+	r := newStalledReader(t, writeTestWAV(t, SampleRate, 1, windowSamples+SampleRate))
+	if err := transcribeReaderWithin(t, w, r, TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded, got %v", err)
+	}
+}
+
+func TestTranscribeReaderStalledStop(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	audioPath := "test/data/jfk.wav"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+	skipIfNoAudio(t, audioPath)
+	skipIfNoFFmpeg(t)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer w.Close()
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	// Repeat the speech past one window so the first window has segments
+	samples, err := decodeWAV(audioPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []int{}
+	for len(data) < windowSamples+SampleRate {
+		for _, s := range samples {
+			data = append(data, int(s*32767))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "speech.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := wav.NewEncoder(f, SampleRate, 16, 1, wavFormatPCM)
+	if err := enc.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: SampleRate}, Data: data, SourceBitDepth: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	stops := 0
+	opts := TranscriptionOptions{Language: "en", OnSegment: func(*Segment) bool {
+		stops++
+		return false
+	}}
+	if err := transcribeReaderWithin(t, w, newStalledReader(t, path), opts); err != nil {
+		t.Fatalf("Failed to transcribe: %v", err)
+	}
+	if stops != 1 {
+		t.Errorf("Expected OnSegment to be called once, got %d", stops)
+	}
+}
+
+// drain collects the segments of the stream until it ends
+func drain(t *testing.T, stream *SegmentStream) []*Segment {
+	t.Helper()
+	segments := []*Segment{}
+	timeout := time.After(60 * time.Second)
+	for {
+		select {
+		case seg, ok := <-stream.C:
+			if !ok {
+				return segments
+			}
+			segments = append(segments, seg)
+		case <-timeout:
+			t.Fatal("TranscribeChannel did not end")
+		}
+	}
+}
+
+func TestTranscribeChannelNoModel(t *testing.T) {
+	w := &Whisper{state: &nativeState{}}
+	if _, err := w.TranscribeChannel(context.Background(), make(chan []float32), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded, got %v", err)
+	}
+}
+
+func TestTranscribeChannelCancel(t *testing.T) {
+	// Nothing reaches the native library before the first window is complete
+	w := &Whisper{state: &nativeState{modelLoaded: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	samples := make(chan []float32)
+	stream, err := w.TranscribeChannel(ctx, samples, TranscriptionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples <- make([]float32, SampleRate)
+	cancel()
+
+	if segments := drain(t, stream); len(segments) != 0 {
+		t.Errorf("Expected no segments, got %d", len(segments))
+	}
+	if !errors.Is(stream.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", stream.Err())
+	}
+}
+
+func TestTranscribeChannelMaxDuration(t *testing.T) {
+	w := &Whisper{state: &nativeState{modelLoaded: true}}
+	samples := make(chan []float32)
+	stream, err := w.TranscribeChannel(context.Background(), samples, TranscriptionOptions{MaxDurationSec: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The limit applies to the total, not to each chunk
+	go func() {
+		for range 3 {
+			select {
+			case samples <- make([]float32, SampleRate):
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+
+	drain(t, stream)
+	if !errors.Is(stream.Err(), ErrAudioTooLong) {
+		t.Errorf("Expected ErrAudioTooLong, got %v", stream.Err())
+	}
+}
+
+func TestTranscribeChannelFlush(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	audioPath := "test/data/jfk.wav"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+	skipIfNoAudio(t, audioPath)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer w.Close()
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+	data, err := decodeWAV(audioPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Less than a window: nothing is transcribed until samples is closed
+	samples := make(chan []float32)
+	stream, err := w.TranscribeChannel(context.Background(), samples, TranscriptionOptions{Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for chunk := range slices.Chunk(data, SampleRate) {
+			samples <- chunk
+		}
+		close(samples)
+	}()
+
+	segments := drain(t, stream)
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Expected the stream to end cleanly, got %v", err)
+	}
+	if len(segments) == 0 {
+		t.Error("Expected segments from the flushed audio")
+	}
+}
+
+func TestWindowCutWithoutVAD(t *testing.T) {
+	w := &Whisper{state: &nativeState{}}
+	window := make([]float32, windowSamples)
+	cut, err := w.windowCut(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cut != len(window) {
+		t.Errorf("Expected the whole window without a VAD model, got %d", cut)
+	}
+}
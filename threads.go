@@ -0,0 +1,72 @@
+package whisper
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// threadsEnv overrides the default number of transcription threads
+const threadsEnv = "GOWHISPER_THREADS"
+
+// defaultThreads returns the number of threads used when TranscriptionOptions.Threads
+// is 0: GOWHISPER_THREADS if it is a positive integer, else the cgroup CPU quota,
+// else runtime.NumCPU
+func defaultThreads() uint32 {
+	if n, err := strconv.ParseUint(os.Getenv(threadsEnv), 10, 32); err == nil && n > 0 {
+		return uint32(n)
+	}
+	if quota := DetectCPUQuota(); quota > 0 {
+		return uint32(min(quota, runtime.NumCPU()))
+	}
+	return uint32(runtime.NumCPU())
+}
+
+// DetectCPUQuota returns the number of CPUs the process may use according to its
+// Linux cgroup CPU quota (cgroup v2 cpu.max or v1 cpu.cfs_quota_us), rounded up,
+// or 0 if there is no quota or it cannot be read. In containers with CPU limits
+// runtime.NumCPU reports the CPUs of the host, which oversubscribes whisper.
+func DetectCPUQuota() int {
+	if runtime.GOOS != "linux" {
+		return 0
+	}
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		return parseCPUMax(string(data))
+	}
+	for _, dir := range []string{"/sys/fs/cgroup/cpu", "/sys/fs/cgroup/cpu,cpuacct"} {
+		quota, err := os.ReadFile(dir + "/cpu.cfs_quota_us")
+		if err != nil {
+			continue
+		}
+		period, err := os.ReadFile(dir + "/cpu.cfs_period_us")
+		if err != nil {
+			continue
+		}
+		return parseCFSQuota(string(quota), string(period))
+	}
+	return 0
+}
+
+// parseCPUMax parses the cgroup v2 cpu.max file, "<quota> <period>" or "max <period>"
+func parseCPUMax(s string) int {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0
+	}
+	return parseCFSQuota(fields[0], fields[1])
+}
+
+// parseCFSQuota returns the quota divided by the period, rounded up. A quota of
+// "max" or -1 means unlimited and returns 0.
+func parseCFSQuota(quota, period string) int {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return int((q + p - 1) / p)
+}
@@ -0,0 +1,95 @@
+package whisper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// defaultMaxDownloadBytes is the download size limit of TranscribeURL when
+// DownloadOptions.MaxBytes is 0
+const defaultMaxDownloadBytes = 1 << 30
+
+// DownloadOptions controls how TranscribeURL fetches the audio
+type DownloadOptions struct {
+	// Client performs the request. Nil uses http.DefaultClient.
+	Client *http.Client
+	// MaxBytes rejects larger downloads. Zero uses the default of 1 GiB.
+	MaxBytes int64
+}
+
+// TranscribeURL downloads the audio at an http or https URL to a temporary file,
+// transcribes it like Transcribe and removes the file. The download is canceled
+// with ctx; the transcription itself is not.
+func (w *Whisper) TranscribeURL(ctx context.Context, rawURL string, dl DownloadOptions, opts TranscriptionOptions) (TranscriptionResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return TranscriptionResult{}, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return TranscriptionResult{}, fmt.Errorf("unsupported URL scheme %q: expected http or https", u.Scheme)
+	}
+
+	dir, err := os.MkdirTemp("", tempDirPrefix)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the extension, it helps decoders guess the container
+	audioFile := filepath.Join(dir, "download"+path.Ext(u.Path))
+	if err := download(ctx, u.String(), audioFile, dl); err != nil {
+		return TranscriptionResult{}, err
+	}
+	return w.Transcribe(audioFile, opts)
+}
+
+// download writes the response body of rawURL to dst, enforcing the size limit of dl
+func download(ctx context.Context, rawURL, dst string, dl DownloadOptions) error {
+	client := dl.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	limit := dl.MaxBytes
+	if limit <= 0 {
+		limit = defaultMaxDownloadBytes
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download audio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download audio: %s", resp.Status)
+	}
+	if resp.ContentLength > limit {
+		return fmt.Errorf("audio at %s is %d bytes, exceeding the limit of %d", rawURL, resp.ContentLength, limit)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Read one byte past the limit to detect bodies without a Content-Length
+	n, err := io.Copy(f, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to download audio: %w", err)
+	}
+	if n > limit {
+		return fmt.Errorf("audio at %s exceeds the limit of %d bytes", rawURL, limit)
+	}
+	return f.Close()
+}
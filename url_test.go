@@ -0,0 +1,42 @@
+package whisper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranscribeURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audio.mp3" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	w := &Whisper{state: &nativeState{}}
+	opts := TranscriptionOptions{Decoder: stubDecoder{[]float32{0, 0}, SampleRate}}
+	ctx := context.Background()
+
+	if _, err := w.TranscribeURL(ctx, "file:///etc/passwd", DownloadOptions{}, opts); err == nil {
+		t.Error("Expected file URL to be rejected")
+	}
+	if _, err := w.TranscribeURL(ctx, srv.URL+"/missing.mp3", DownloadOptions{}, opts); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+
+	limited := DownloadOptions{Client: srv.Client(), MaxBytes: 50}
+	if _, err := w.TranscribeURL(ctx, srv.URL+"/audio.mp3", limited, opts); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("Expected size limit error, got %v", err)
+	}
+
+	// The download succeeds and transcription fails without a model
+	if _, err := w.TranscribeURL(ctx, srv.URL+"/audio.mp3", DownloadOptions{}, opts); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded after download, got %v", err)
+	}
+}
@@ -1,12 +1,22 @@
 package whisper
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/go-audio/wav"
@@ -14,17 +24,92 @@ import (
 
 // Whisper struct encapsulates the library instance and its methods
 type Whisper struct {
+	nativeLibrary
+	// mu guards the instance's library handle and state pointer
+	mu sync.Mutex
+	// state is shared with every instance that opened the same library
+	state *nativeState
+}
+
+// nativeState tracks the globals of a loaded library. dlopen returns the same
+// handle for every instance that opens the same file, so those instances share
+// one model, one set of results and one lock.
+type nativeState struct {
+	// mu serializes native calls, the native library keeps its model and results in globals
+	mu          sync.Mutex
+	refs        int
+	modelLoaded bool
+	vadLoaded   bool
+	// tokens caches the special token ids of the loaded model
+	tokens *specialTokens
+}
+
+var (
+	// statesMu guards states and the reference counts in it
+	statesMu sync.Mutex
+	states   = map[uintptr]*nativeState{}
+)
+
+// acquireState returns the shared state of the library handle and counts the caller as a user.
+func acquireState(handle uintptr) *nativeState {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+
+	st := states[handle]
+	if st == nil {
+		st = &nativeState{}
+		states[handle] = st
+	}
+	st.refs++
+	return st
+}
+
+// lock locks the instance and the native state it shares with other instances.
+func (w *Whisper) lock() {
+	w.mu.Lock()
+	w.state.mu.Lock()
+}
+
+func (w *Whisper) unlock() {
+	w.state.mu.Unlock()
+	w.mu.Unlock()
+}
+
+// nativeLibrary holds an opened library and the functions registered from it
+type nativeLibrary struct {
 	// Function pointers to be loaded from the shared library
 	cppLoadModel                 func(modelPath string) int
 	cppLoadModelVAD              func(modelPath string) int
-	cppVAD                       func(pcmf32 []float32, pcmf32Size uintptr, segsOut unsafe.Pointer, segsOutLen unsafe.Pointer) int
-	cppTranscribe                func(threads uint32, lang string, translate bool, diarize bool, pcmf32 []float32, pcmf32Len uintptr, segsOutLen unsafe.Pointer, prompt string) int
+	cppFreeModel                 func()
+	cppVAD                       func(pcmf32 []float32, pcmf32Size uintptr, segsOut unsafe.Pointer, segsOutLen unsafe.Pointer, threshold float32, minSpeechMs int, minSilenceMs int, maxSpeechSec float32, speechPadMs int) int
+	cppTranscribe                func(threads uint32, lang string, translate bool, diarize bool, pcmf32 []float32, pcmf32Len uintptr, segsOutLen unsafe.Pointer, prompt string, noTimestamps bool, tokenTimestamps bool, processors int, onSegments uintptr, userData uintptr) int
 	cppGetSegmentText            func(i int) string
 	cppGetSegmentStart           func(i int) int64
 	cppGetSegmentEnd             func(i int) int64
 	cppNTokens                   func(i int) int
 	cppGetTokenID                func(i int, j int) int
+	cppGetTokenP                 func(i int, j int) float32
+	cppGetTokenText              func(i int, j int) string
+	cppGetTokenStart             func(i int, j int) int64
+	cppGetTokenEnd               func(i int, j int) int64
 	cppGetSegmentSpeakerTurnNext func(i int) bool
+	cppIsMultilingual            func() bool
+	cppNVocab                    func() int
+	cppTokenEOT                  func() int
+	cppTokenSOT                  func() int
+	cppTokenTranslate            func() int
+	cppTokenTranscribe           func() int
+	cppTokenBeg                  func() int
+	cppFullLang                  func() string
+	cppLangMaxID                 func() int
+	cppLangStr                   func(id int) string
+	cppDetectLanguage            func(pcmf32 []float32, pcmf32Len uintptr, threads uint32, langProbs []float32) int
+	cppModelType                 func() string
+	cppModelNAudioCtx            func() int
+	cppModelNAudioLayer          func() int
+	cppModelNTextCtx             func() int
+	cppModelNTextLayer           func() int
+	cppModelNMels                func() int
 	libHandle                    uintptr
 }
 
@@ -33,6 +118,10 @@ type Whisper struct {
 // If libPath is a directory, it attempts to find the best available library in that directory.
 // If libPath is empty, it attempts to find the best available library in the current directory.
 // Returns an error if no library is found.
+//
+// Instances opened from the same library file share its native state: a model
+// loaded by one is the model of all of them and their calls are serialized. The
+// models are freed when the last of them is closed.
 func New(libPath string) (*Whisper, error) {
 	w := &Whisper{}
 
@@ -52,63 +141,186 @@ func New(libPath string) (*Whisper, error) {
 		path = libPath
 	}
 
-	// Load the library
+	lib, err := openLibrary(path)
+	if err != nil {
+		return nil, err
+	}
+	w.nativeLibrary = *lib
+	w.state = acquireState(lib.libHandle)
+
+	// Safety net for instances that are never closed. It only drops the handle:
+	// other instances may still use the shared model, and the finalizer runs at an
+	// arbitrary point, so a model leaked this way stays loaded until the process exits.
+	runtime.SetFinalizer(w, func(w *Whisper) {
+		log.Printf("whisper: instance garbage collected without Close, closing its library handle; call Close explicitly to free the models")
+		w.releaseLibrary(false)
+	})
+
+	return w, nil
+}
+
+// optionalSymbols may be missing from the library, for example in builds without
+// tinydiarize. Their functions stay nil and the feature is reported as unsupported.
+var optionalSymbols = []string{"get_segment_speaker_turn_next"}
+
+// openLibrary loads the library at path and registers its functions.
+// It fails if the file is not a library for this platform or a symbol is missing.
+func openLibrary(path string) (*nativeLibrary, error) {
 	// Convert to absolute path to ensure dlopen can find it
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
 	}
 
-	lib, err := loadLibrary(absPath)
+	if err := checkLibraryFormat(absPath, runtime.GOOS); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "linux" {
+		if err := checkGlibcVersion(absPath); err != nil {
+			return nil, err
+		}
+	}
+
+	handle, err := loadLibrary(absPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open library at %s: %w", absPath, err)
 	}
 
+	lib := &nativeLibrary{libHandle: handle}
+	symbols := []struct {
+		fn   interface{}
+		name string
+	}{
+		{&lib.cppLoadModel, "load_model"},
+		{&lib.cppLoadModelVAD, "load_model_vad"},
+		{&lib.cppFreeModel, "free_model"},
+		{&lib.cppVAD, "vad"},
+		{&lib.cppTranscribe, "transcribe"},
+		{&lib.cppGetSegmentText, "get_segment_text"},
+		{&lib.cppGetSegmentStart, "get_segment_t0"},
+		{&lib.cppGetSegmentEnd, "get_segment_t1"},
+		{&lib.cppNTokens, "n_tokens"},
+		{&lib.cppGetTokenID, "get_token_id"},
+		{&lib.cppGetTokenP, "get_token_p"},
+		{&lib.cppGetTokenText, "get_token_text"},
+		{&lib.cppGetTokenStart, "get_token_t0"},
+		{&lib.cppGetTokenEnd, "get_token_t1"},
+		{&lib.cppGetSegmentSpeakerTurnNext, "get_segment_speaker_turn_next"},
+		{&lib.cppIsMultilingual, "is_multilingual"},
+		{&lib.cppNVocab, "n_vocab"},
+		{&lib.cppTokenEOT, "token_eot"},
+		{&lib.cppTokenSOT, "token_sot"},
+		{&lib.cppTokenTranslate, "token_translate"},
+		{&lib.cppTokenTranscribe, "token_transcribe"},
+		{&lib.cppTokenBeg, "token_beg"},
+		{&lib.cppFullLang, "full_lang"},
+		{&lib.cppLangMaxID, "lang_max_id"},
+		{&lib.cppLangStr, "lang_str"},
+		{&lib.cppDetectLanguage, "detect_language"},
+		{&lib.cppModelType, "model_type"},
+		{&lib.cppModelNAudioCtx, "model_n_audio_ctx"},
+		{&lib.cppModelNAudioLayer, "model_n_audio_layer"},
+		{&lib.cppModelNTextCtx, "model_n_text_ctx"},
+		{&lib.cppModelNTextLayer, "model_n_text_layer"},
+		{&lib.cppModelNMels, "model_n_mels"},
+	}
+
 	// Register function pointers
-	registerLibFunc(&w.cppLoadModel, lib, "load_model")
-	registerLibFunc(&w.cppLoadModelVAD, lib, "load_model_vad")
-	registerLibFunc(&w.cppVAD, lib, "vad")
-	registerLibFunc(&w.cppTranscribe, lib, "transcribe")
-	registerLibFunc(&w.cppGetSegmentText, lib, "get_segment_text")
-	registerLibFunc(&w.cppGetSegmentStart, lib, "get_segment_t0")
-	registerLibFunc(&w.cppGetSegmentEnd, lib, "get_segment_t1")
-	registerLibFunc(&w.cppNTokens, lib, "n_tokens")
-	registerLibFunc(&w.cppGetTokenID, lib, "get_token_id")
-	registerLibFunc(&w.cppGetSegmentSpeakerTurnNext, lib, "get_segment_speaker_turn_next")
-
-	w.libHandle = lib
+	for _, sym := range symbols {
+		if err := registerLibFunc(sym.fn, handle, sym.name); err != nil {
+			if slices.Contains(optionalSymbols, sym.name) {
+				continue
+			}
+			closeLibrary(handle)
+			return nil, fmt.Errorf("library %s is missing symbol %s, it is older than this package and must be rebuilt from native/: %w", absPath, sym.name, err)
+		}
+	}
 
-	return w, nil
+	return lib, nil
 }
 
-// Close closes the Whisper instance and unloads the library
-func (w *Whisper) Close() error {
+// ReloadLibrary replaces the loaded library with the one at path, for example to
+// upgrade it without restarting the process. The new library must be at a
+// different path than the current one: opening the same path again returns the
+// library that is already loaded, so a file replaced in place is not picked up.
+// The new library is opened first, so on error the instance keeps using the
+// current one. On success the instance starts without models and must load them
+// again with Load and LoadVAD.
+func (w *Whisper) ReloadLibrary(path string) error {
+	lib, err := openLibrary(path)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if lib.libHandle == w.libHandle {
+		closeLibrary(lib.libHandle)
+		return fmt.Errorf("library %s is already loaded, install the new version at a different path to reload it", path)
+	}
 	if w.libHandle != 0 {
-		return closeLibrary(w.libHandle)
+		w.state.mu.Lock()
+		err := w.releaseLibrary(true)
+		w.state.mu.Unlock()
+		if err != nil {
+			log.Printf("whisper: failed to close previous library: %v", err)
+		}
 	}
+	w.nativeLibrary = *lib
+	w.state = acquireState(lib.libHandle)
 	return nil
 }
 
-func findBestLibrary(dir string) string {
-	// Platform-specific library extensions
-	ext := ".so"
-	prefix := "lib"
+// releaseLibrary drops the instance's reference to the shared state and closes
+// its library handle. The last instance frees the native models first if
+// freeModels is set, dlclose does not free them. The finalizer passes false: it
+// must never touch native state, and with freeModels set the caller must hold
+// the lock.
+func (w *Whisper) releaseLibrary(freeModels bool) error {
+	statesMu.Lock()
+	st := w.state
+	if st.refs--; st.refs == 0 {
+		delete(states, w.libHandle)
+		if freeModels {
+			w.cppFreeModel()
+		}
+		st.modelLoaded = false
+		st.vadLoaded = false
+		st.tokens = nil
+	}
+	statesMu.Unlock()
+	return closeLibrary(w.libHandle)
+}
 
-	switch runtime.GOOS {
-	case "darwin":
-		// macOS uses .dylib or .so
-		ext = ".dylib"
-	case "windows":
-		// Windows uses .dll
-		ext = ".dll"
-		prefix = ""
+// Close closes the Whisper instance and unloads the library. The models are
+// freed if no other instance shares them. It is safe to call more than once.
+func (w *Whisper) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	runtime.SetFinalizer(w, nil)
+
+	if w.libHandle == 0 {
+		return nil
 	}
+	w.state.mu.Lock()
+	err := w.releaseLibrary(true)
+	w.state.mu.Unlock()
+	w.nativeLibrary = nativeLibrary{}
+	w.state = &nativeState{}
+	return err
+}
 
+func findBestLibrary(dir string) string {
 	// Always use fallback variant for maximum compatibility
 	// This avoids SIGILL errors on CPUs that don't support AVX/AVX2/AVX512
-	path := filepath.Join(dir, prefix+"gowhisper-fallback"+ext)
-	if _, err := os.Stat(path); err == nil {
-		return path
+	// Prefer an arch-qualified build, then the plain name used by existing releases
+	for _, name := range []string{LibraryNameArch(runtime.GOOS, runtime.GOARCH), LibraryName(runtime.GOOS)} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
 	}
 
 	return ""
@@ -117,19 +329,28 @@ func findBestLibrary(dir string) string {
 // LibraryName returns the platform-specific library name for the given OS.
 // Pass runtime.GOOS for the current platform.
 func LibraryName(goos string) string {
-	var prefix, extension string
+	prefix, extension := libraryAffixes(goos)
+	return prefix + "gowhisper-fallback" + extension
+}
+
+// LibraryNameArch returns the arch-qualified library name for the given OS and
+// architecture, e.g. libgowhisper-fallback-arm64.so. Use it to keep builds for
+// several architectures side by side.
+func LibraryNameArch(goos, goarch string) string {
+	prefix, extension := libraryAffixes(goos)
+	return prefix + "gowhisper-fallback-" + goarch + extension
+}
+
+// libraryAffixes returns the library file prefix and extension for the given OS
+func libraryAffixes(goos string) (prefix, extension string) {
 	switch goos {
 	case "darwin":
-		prefix = "lib"
-		extension = ".dylib"
+		return "lib", ".dylib"
 	case "windows":
-		prefix = ""
-		extension = ".dll"
+		return "", ".dll"
 	default: // Linux
-		prefix = "lib"
-		extension = ".so"
+		return "lib", ".so"
 	}
-	return prefix + "gowhisper-fallback" + extension
 }
 
 // ModelOptions represents options for loading a model
@@ -143,49 +364,345 @@ func (w *Whisper) Load(modelPath string) error {
 	// This simplifies the logic. Original code accepted generic "options" but only checked for "vad_only".
 	// We can assume based on usage or just try loading.
 	// For now, let's just expose LoadModel and LoadModelVAD separately or via a flag.
+	w.lock()
+	defer w.unlock()
+
+	// The native loader drops the current model before loading, so a failed load
+	// leaves no model behind
+	w.state.modelLoaded = false
+	w.state.tokens = nil
 	if ret := w.cppLoadModel(modelPath); ret != 0 {
-		return fmt.Errorf("failed to load Whisper transcription model from %s", modelPath)
+		nerr := &NativeError{Op: "load_model", Code: ret}
+		// The header tells a truncated or foreign file apart from a model that
+		// failed later, e.g. for lack of memory
+		hp, err := readModelHParams(modelPath)
+		if err != nil {
+			return fmt.Errorf("failed to load Whisper transcription model from %s (%v): %w", modelPath, err, nerr)
+		}
+		return fmt.Errorf("failed to load Whisper transcription model from %s (%s): %w", modelPath, hp, nerr)
 	}
+	w.state.modelLoaded = true
 	return nil
 }
 
+// IsMultilingual reports whether the loaded transcription model supports languages
+// other than English. English-only models (the .en variants) cannot translate.
+// It returns false if no model is loaded.
+func (w *Whisper) IsMultilingual() bool {
+	w.lock()
+	defer w.unlock()
+	return w.state.modelLoaded && w.cppIsMultilingual()
+}
+
+// VocabSize returns the vocabulary size of the loaded model, including special
+// tokens, or 0 if no model is loaded
+func (w *Whisper) VocabSize() int {
+	w.lock()
+	defer w.unlock()
+	if !w.state.modelLoaded {
+		return 0
+	}
+	return w.cppNVocab()
+}
+
+// specialTokens holds the special token ids of a model
+type specialTokens struct {
+	eot, sot, translate, transcribe, beg int
+}
+
+// specialTokens returns the special token ids of the loaded model, querying them
+// once per model. All ids are -1 if no model is loaded. The caller must hold the lock.
+func (w *Whisper) specialTokens() specialTokens {
+	if !w.state.modelLoaded {
+		return specialTokens{eot: -1, sot: -1, translate: -1, transcribe: -1, beg: -1}
+	}
+	if w.state.tokens == nil {
+		w.state.tokens = &specialTokens{
+			eot:        w.cppTokenEOT(),
+			sot:        w.cppTokenSOT(),
+			translate:  w.cppTokenTranslate(),
+			transcribe: w.cppTokenTranscribe(),
+			beg:        w.cppTokenBeg(),
+		}
+	}
+	return *w.state.tokens
+}
+
+// TokenEOT returns the end of text token id of the loaded model.
+// It is the first special token: ids below it are text tokens, ids from it upwards
+// are special tokens (start of transcript, languages, tasks and timestamps).
+// Like the other token accessors it returns -1 if no model is loaded.
+func (w *Whisper) TokenEOT() int {
+	w.lock()
+	defer w.unlock()
+	return w.specialTokens().eot
+}
+
+// TokenBOS returns the start of transcript token id of the loaded model, which
+// begins every decoder prompt
+func (w *Whisper) TokenBOS() int {
+	w.lock()
+	defer w.unlock()
+	return w.specialTokens().sot
+}
+
+// TokenTranslate returns the id of the task token selecting translation to English
+func (w *Whisper) TokenTranslate() int {
+	w.lock()
+	defer w.unlock()
+	return w.specialTokens().translate
+}
+
+// TokenTranscribe returns the id of the task token selecting transcription
+func (w *Whisper) TokenTranscribe() int {
+	w.lock()
+	defer w.unlock()
+	return w.specialTokens().transcribe
+}
+
+// TokenTimestampBegin returns the id of the first timestamp token, <|0.00|>.
+// Token id TokenTimestampBegin()+n is the timestamp n*20ms into the window.
+func (w *Whisper) TokenTimestampBegin() int {
+	w.lock()
+	defer w.unlock()
+	return w.specialTokens().beg
+}
+
+// ModelInfo describes the loaded transcription model
+type ModelInfo struct {
+	// Type is the model size as reported by whisper.cpp: tiny, base, small, medium
+	// or large (large-v3-turbo models report large)
+	Type         string
+	Multilingual bool
+	VocabSize    int
+	AudioCtx     int // encoder context, 1500 frames for 30 seconds of audio
+	AudioLayers  int
+	TextCtx      int // decoder context in tokens
+	TextLayers   int
+	Mels         int // mel bands, 128 for large-v3 models and 80 otherwise
+}
+
+// ModelInfo returns the metadata of the loaded transcription model
+func (w *Whisper) ModelInfo() (ModelInfo, error) {
+	w.lock()
+	defer w.unlock()
+
+	if !w.state.modelLoaded {
+		return ModelInfo{}, ErrModelNotLoaded
+	}
+	return ModelInfo{
+		Type:         w.cppModelType(),
+		Multilingual: w.cppIsMultilingual(),
+		VocabSize:    w.cppNVocab(),
+		AudioCtx:     w.cppModelNAudioCtx(),
+		AudioLayers:  w.cppModelNAudioLayer(),
+		TextCtx:      w.cppModelNTextCtx(),
+		TextLayers:   w.cppModelNTextLayer(),
+		Mels:         w.cppModelNMels(),
+	}, nil
+}
+
 // LoadVAD loads the VAD model
 func (w *Whisper) LoadVAD(modelPath string) error {
+	w.lock()
+	defer w.unlock()
+
+	w.state.vadLoaded = false
 	if ret := w.cppLoadModelVAD(modelPath); ret != 0 {
-		return fmt.Errorf("failed to load Whisper VAD model from %s", modelPath)
+		return fmt.Errorf("failed to load Whisper VAD model from %s: %w", modelPath, &NativeError{Op: "load_model_vad", Code: ret})
 	}
+	w.state.vadLoaded = true
 	return nil
 }
 
-// VADSegment represents a voice activity detection segment
+// Warmup runs a short transcription of silence to force the lazy native
+// initialization, so the first real Transcribe call has predictable latency.
+// Calling it is optional; the model must be loaded first.
+func (w *Whisper) Warmup() error {
+	if _, err := w.transcribeSilence(); err != nil {
+		return fmt.Errorf("warmup failed: %w", err)
+	}
+	return nil
+}
+
+// transcribeSilence transcribes a second of silence, the probe shared by Warmup and SelfTest
+func (w *Whisper) transcribeSilence() (TranscriptionResult, error) {
+	return w.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{
+		Threads:  1,
+		Language: "en",
+	})
+}
+
+// selfTestMaxSegments is the number of segments tolerated on silence, whisper may
+// emit a marker such as [BLANK_AUDIO]
+const selfTestMaxSegments = 1
+
+// SelfTest checks the whole pipeline (library symbols, loaded model and native
+// inference) by transcribing a second of silence. It returns an error if the call
+// fails or produces more than a blank marker, and can be used as a liveness probe.
+func (w *Whisper) SelfTest() error {
+	res, err := w.transcribeSilence()
+	if err != nil {
+		return fmt.Errorf("self-test failed: %w", err)
+	}
+	if len(res.Segments) > selfTestMaxSegments {
+		return fmt.Errorf("self-test failed: expected at most %d segments on silence, got %d", selfTestMaxSegments, len(res.Segments))
+	}
+	return nil
+}
+
+// VADSegment represents a voice activity detection segment.
+// The native library reports VAD times in centiseconds, which are converted to seconds.
 type VADSegment struct {
-	Start float32
-	End   float32
+	Start float32 // seconds
+	End   float32 // seconds
+}
+
+// StartDuration returns the segment start as a time.Duration
+func (s VADSegment) StartDuration() time.Duration {
+	return secondsToDuration(s.Start)
+}
+
+// EndDuration returns the segment end as a time.Duration
+func (s VADSegment) EndDuration() time.Duration {
+	return secondsToDuration(s.End)
+}
+
+// SampleRange returns the sample indices [start, end) covered by the segment at the
+// given sample rate, for slicing the n samples passed to VAD. The start is rounded
+// down and the end up so the whole speech region is included. Both are clamped to
+// [0, n], so samples[start:end] is always valid even when VAD reports times past
+// the end of the audio.
+func (s VADSegment) SampleRange(sampleRate, n int) (start, end int) {
+	start = min(n, max(0, int(math.Floor(float64(s.Start)*float64(sampleRate)))))
+	end = min(n, max(start, int(math.Ceil(float64(s.End)*float64(sampleRate)))))
+	return start, end
+}
+
+// VADOptions configuration for voice activity detection.
+// Zero values use the whisper.cpp defaults.
+type VADOptions struct {
+	Threshold            float32  // speech probability threshold
+	MinSpeechDurationMs  int      // minimum duration of a speech segment
+	MinSilenceDurationMs int      // minimum silence duration to split segments
+	MaxSpeechDurationSec float32  // maximum duration of a speech segment before it is split
+	SpeechPadMs          int      // padding added before and after each segment
+	FFmpegArgs           []string // extra ffmpeg arguments, see TranscriptionOptions.FFmpegArgs
 }
 
 // VAD performs voice activity detection
 func (w *Whisper) VAD(audio []float32) ([]VADSegment, error) {
+	return w.vad(audio, VADOptions{})
+}
+
+// VADFile performs voice activity detection on an audio file.
+// The file is converted the same way as in Transcribe, so segment times are
+// in seconds on the original timeline.
+func (w *Whisper) VADFile(audioFile string, opts VADOptions) ([]VADSegment, error) {
+	data, err := readAudioFile(audioFile, conversion{ffmpegArgs: opts.FFmpegArgs})
+	if err != nil {
+		return nil, err
+	}
+	return w.vad(data, opts)
+}
+
+// SplitOnVAD runs voice activity detection on the audio file and writes every
+// speech segment to its own 16kHz mono WAV file in outputDir, which is created if
+// needed. Files are named by index and time in seconds, e.g. 0003_12.340-15.200.wav.
+// It returns the paths of the written files in segment order.
+func (w *Whisper) SplitOnVAD(audioFile, outputDir string, opts VADOptions) ([]string, error) {
+	segments, err := w.VADFile(audioFile, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		start, end := strconv.FormatFloat(float64(seg.Start), 'f', 3, 32), strconv.FormatFloat(float64(seg.End), 'f', 3, 32)
+		path := filepath.Join(outputDir, fmt.Sprintf("%04d_%s-%s.wav", i, start, end))
+
+		// Cut after the same filters VADFile applied, so the times line up
+		args := append(slices.Clip(opts.FFmpegArgs), "-ss", start, "-to", end)
+		if err := audioToWav(audioFile, path, args); err != nil {
+			return paths, fmt.Errorf("failed to write segment %d: %w", i, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// vadChunkSamples is the amount of audio VADContext processes between cancellation checks
+const vadChunkSamples = 60 * SampleRate
+
+// vadMergeGap is the largest gap, in seconds, around a chunk boundary across which
+// VADContext joins two segments into one
+const vadMergeGap = 0.1
+
+// VADContext performs voice activity detection that can be cancelled through ctx.
+// The native VAD cannot be interrupted, so the audio is processed in one minute
+// chunks and ctx is checked between them; segments cut by a chunk boundary are
+// joined again. On cancellation ctx.Err() is returned.
+func (w *Whisper) VADContext(ctx context.Context, audio []float32, opts VADOptions) ([]VADSegment, error) {
+	segments := []VADSegment{}
+	for offset := 0; offset < len(audio); offset += vadChunkSamples {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		end := min(offset+vadChunkSamples, len(audio))
+		chunk, err := w.vad(audio[offset:end], opts)
+		if err != nil {
+			return nil, err
+		}
+
+		boundary := float32(offset) / SampleRate
+		for _, seg := range chunk {
+			seg.Start += boundary
+			seg.End += boundary
+			if n := len(segments); n > 0 && segments[n-1].End >= boundary-vadMergeGap && seg.Start <= boundary+vadMergeGap {
+				segments[n-1].End = seg.End
+				continue
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments, nil
+}
+
+func (w *Whisper) vad(audio []float32, opts VADOptions) ([]VADSegment, error) {
+	w.lock()
+	defer w.unlock()
+
+	if !w.state.vadLoaded {
+		return nil, ErrVADModelNotLoaded
+	}
+
 	// We expect 0xdeadbeef to be overwritten and if we see it in a stack trace we know it wasn't
-	segsPtr, segsLen := uintptr(0xdeadbeef), uintptr(0xdeadbeef)
+	var segsPtr *float32
+	segsLen := uintptr(0xdeadbeef)
 	segsPtrPtr, segsLenPtr := unsafe.Pointer(&segsPtr), unsafe.Pointer(&segsLen)
 
-	if ret := w.cppVAD(audio, uintptr(len(audio)), segsPtrPtr, segsLenPtr); ret != 0 {
-		return nil, fmt.Errorf("failed VAD execution")
+	if ret := w.cppVAD(audio, uintptr(len(audio)), segsPtrPtr, segsLenPtr,
+		opts.Threshold, opts.MinSpeechDurationMs, opts.MinSilenceDurationMs, opts.MaxSpeechDurationSec, opts.SpeechPadMs); ret != 0 {
+		return nil, &NativeError{Op: "vad", Code: ret}
 	}
 
 	// Happens when CPP vector has not had any elements pushed to it
-	if segsPtr == 0 {
+	if segsPtr == nil {
 		return []VADSegment{}, nil
 	}
 
-	// unsafeptr warning is caused by segsPtr being on the stack and therefor being subject to stack copying AFAICT
-	// however the stack shouldn't have grown between setting segsPtr and now, also the memory pointed to is allocated by C++
-	segs := unsafe.Slice((*float32)(unsafe.Pointer(segsPtr)), segsLen)
+	// The memory pointed to is allocated by C++ and stays valid until the next VAD call
+	segs := unsafe.Slice(segsPtr, segsLen)
 
 	vadSegments := []VADSegment{}
 	for i := range len(segs) >> 1 {
-		s := segs[2*i] / 100
-		t := segs[2*i+1] / 100
+		s := segs[2*i] / centisecondsPerSecond
+		t := segs[2*i+1] / centisecondsPerSecond
 		vadSegments = append(vadSegments, VADSegment{
 			Start: s,
 			End:   t,
@@ -195,111 +712,766 @@ func (w *Whisper) VAD(audio []float32) ([]VADSegment, error) {
 	return vadSegments, nil
 }
 
+// NativeError is returned when a native library call fails.
+// Use errors.As to inspect the return code of the C function.
+type NativeError struct {
+	Op   string // name of the native function
+	Code int    // nonzero return value
+}
+
+func (e *NativeError) Error() string {
+	return fmt.Sprintf("failed %s execution: native error code %d", e.Op, e.Code)
+}
+
+// ErrModelNotLoaded is returned when transcribing before a model was loaded with Load
+var ErrModelNotLoaded = errors.New("no transcription model loaded")
+
+// ErrVADModelNotLoaded is returned by the VAD methods before a model was loaded with LoadVAD
+var ErrVADModelNotLoaded = errors.New("no VAD model loaded")
+
+// ErrTranslationUnsupported is returned by Transcribe when Translate is set but the
+// loaded model is English-only. Translation requires a multilingual model.
+var ErrTranslationUnsupported = errors.New("translation requires a multilingual model")
+
+// ErrDiarizationUnsupported is returned by Transcribe when Diarize is set but the
+// library was built without speaker turn detection
+var ErrDiarizationUnsupported = errors.New("diarization is not supported by the loaded library")
+
+// ErrAudioTooLong is returned when the audio is longer than
+// TranscriptionOptions.MaxDurationSec; TranscriptionResult.Duration holds its length
+var ErrAudioTooLong = errors.New("audio is too long")
+
+// ErrInvalidUTF8 is returned by Transcribe when a segment contains text that is
+// not valid UTF-8 and TranscriptionOptions.InvalidUTF8 is UTF8Strict
+var ErrInvalidUTF8 = errors.New("segment text is not valid UTF-8")
+
+// InvalidUTF8Policy controls how segment text that is not valid UTF-8 is handled.
+// This is rare, but can happen with corrupted models.
+type InvalidUTF8Policy int
+
+const (
+	// UTF8Replace replaces invalid byte sequences with the Unicode replacement rune (default)
+	UTF8Replace InvalidUTF8Policy = iota
+	// UTF8Strict fails the transcription with ErrInvalidUTF8
+	UTF8Strict
+	// UTF8Passthrough keeps the text exactly as returned by the native library
+	UTF8Passthrough
+)
+
 // TranscriptionOptions configuration for transcription
 type TranscriptionOptions struct {
-	Threads   uint32
-	Language  string
-	Translate bool
-	Diarize   bool
-	Prompt    string
+	// Threads is the number of threads whisper uses. When 0 it defaults to the
+	// GOWHISPER_THREADS environment variable, else the Linux cgroup CPU quota (see
+	// DetectCPUQuota), else runtime.NumCPU.
+	Threads     uint32
+	Language    string
+	Translate   bool
+	Diarize     bool
+	Prompt      string
+	InvalidUTF8 InvalidUTF8Policy
+	// FFmpegArgs are extra arguments inserted into the conversion command after
+	// the input and before the output, e.g. []string{"-af", "highpass=f=200,loudnorm"}.
+	// The sample rate, channel and codec flags are required by whisper and cannot be overridden.
+	FFmpegArgs []string
+	// NumSpeakers is a hint for diarization. When set together with Diarize, segments
+	// are labeled SPEAKER_00, SPEAKER_01, ... rotating on every detected speaker turn.
+	// This is a heuristic since tinydiarize only detects turns, not identities.
+	NumSpeakers int
+	// Hotwords are domain terms (product names, jargon) appended to the initial prompt
+	// as a comma-separated list to bias recognition. whisper only uses the last
+	// maxPromptTokens tokens of the prompt, so a warning is logged when the terms
+	// are likely to be truncated.
+	Hotwords []string
+	// DeduplicateSegments removes segments duplicated across window boundaries,
+	// see deduplicateSegments for the overlap and similarity thresholds.
+	DeduplicateSegments bool
+	// IntermediateFormat is the format of the temporary converted file. FLAC is lossless
+	// and uses much less temp disk for long inputs at the cost of some CPU. Defaults to WAV.
+	IntermediateFormat IntermediateFormat
+	// OnSegment is called for every segment as soon as it is decoded. Returning false
+	// aborts the transcription and returns the segments collected so far. The segment
+	// is the one stored in the result, so mutating it is the caller's responsibility.
+	// Like TransformSegment it runs under the instance lock.
+	OnSegment func(*Segment) bool
+	// TextJoiner separates segments in TranscriptionResult.Text. When empty it is
+	// chosen from the language: no separator for Chinese, Japanese and other
+	// languages written without spaces, a single space otherwise.
+	TextJoiner string
+	// Checkpoint is a file where progress is saved while transcribing, so an
+	// interrupted job can continue with ResumeTranscription. The audio is then
+	// transcribed in CheckpointInterval chunks (default 5 minutes), so words at
+	// chunk boundaries may be split. The file is removed when the job completes.
+	Checkpoint         string
+	CheckpointInterval time.Duration
+	// ExcludeSpecialTokens removes special tokens (end of text, start of transcript,
+	// language, task and timestamp tokens) from Segment.Tokens, keeping only text tokens.
+	// Token ids >= TokenEOT() are special. By default all tokens are included.
+	ExcludeSpecialTokens bool
+	// ChannelSpeakerNames enables per-channel diarization for recordings with one
+	// speaker per channel, such as call-center stereo. Each channel is transcribed
+	// separately, its segments are labeled with the name at the channel's index
+	// (e.g. []string{"Agent", "Customer"}) and all segments are merged by start time.
+	// The number of names must match the number of channels.
+	ChannelSpeakerNames []string
+	// EnglishOnly sets up transcription for English audio and .en models: Language
+	// is forced to "en", which skips language detection, and Translate is disabled.
+	// A warning is logged when it overrides another language.
+	EnglishOnly bool
+	// NormalizeGain amplifies quiet audio to about -20 dBFS RMS before transcription,
+	// limiting the gain so that no sample clips. Loud audio is left unchanged.
+	NormalizeGain bool
+	// NoTimestamps disables timestamp decoding, which is faster when only the text
+	// is needed. Segment Start and End are then unreliable and may be zero.
+	NoTimestamps bool
+	// Decoder reads audio files instead of ffmpeg; FFmpegArgs and IntermediateFormat
+	// are then ignored. It is not used with ChannelSpeakerNames, which needs the
+	// separate channels that only the ffmpeg conversion provides.
+	Decoder AudioDecoder
+	// MinLanguageProb is the probability the detected language must reach when the
+	// language is auto-detected. Below it FallbackLanguage is used, or when that is
+	// empty the transcription fails with ErrLanguageUncertain. Zero disables the check.
+	MinLanguageProb  float32
+	FallbackLanguage string
+	// CandidateLanguages restricts auto-detection to these language codes, e.g.
+	// []string{"en", "es", "fr"}. Their probabilities are renormalized over the set
+	// before MinLanguageProb is applied.
+	CandidateLanguages []string
+	// TransformSegment is called for every segment before it is collected, so its
+	// text can be rewritten in place, e.g. to redact personal data. Changes show up
+	// in OnSegment, streamed output and TranscriptionResult.Text. It runs under the
+	// instance lock and must not call methods of the Whisper instance.
+	TransformSegment func(*Segment)
+	// MaxCompressionRatio drops segments whose text compression ratio (length over
+	// zlib compressed length) exceeds it, which catches hallucinated repetition
+	// loops. OpenAI's whisper uses 2.4. Zero disables the filter.
+	MaxCompressionRatio float32
+	// RemoveDCOffset subtracts the mean from the samples before the native call,
+	// after decoding and before NormalizeGain. It also logs a warning when more than
+	// 0.1% of the samples are clipped at full scale.
+	RemoveDCOffset bool
+	// WordTimestamps enables token level timestamps in whisper and fills
+	// Segment.Words. Word times are estimated from the token timings and are less
+	// precise than segment times.
+	WordTimestamps bool
+	// Processors splits the audio into that many parts transcribed in parallel,
+	// each using Threads threads. The parts do not share decoding context, so words
+	// at the split points may be lost or garbled. 0 or 1 processes the audio in one pass.
+	Processors int
+	// MaxDurationSec rejects audio longer than this many seconds with ErrAudioTooLong
+	// after decoding and before any native work, e.g. to protect a service from
+	// huge uploads. Zero disables the limit.
+	MaxDurationSec int
+	// ConversionCacheDir keeps converted audio in this directory under a name derived
+	// from the SHA-256 of the input file and the conversion settings, and reuses it
+	// on later runs instead of running ffmpeg again. The cache is never pruned.
+	// Empty converts into a temporary directory that is removed afterwards.
+	ConversionCacheDir string
+	// SilenceGateDB returns an empty result without running whisper when the RMS
+	// level of the whole audio, in dBFS, is below it. Near-silent audio otherwise
+	// costs a full transcription and often yields hallucinated text. -50 skips dead
+	// air while keeping quiet speech, which is usually above -40. It is checked after
+	// RemoveDCOffset and before NormalizeGain. Zero disables the gate.
+	SilenceGateDB float32
+}
+
+// checkDuration returns ErrAudioTooLong when n samples exceed opts.MaxDurationSec
+func (o TranscriptionOptions) checkDuration(n int) error {
+	if o.MaxDurationSec > 0 && n > o.MaxDurationSec*SampleRate {
+		return fmt.Errorf("%w: %s exceeds the limit of %ds", ErrAudioTooLong, samplesDuration(n), o.MaxDurationSec)
+	}
+	return nil
 }
 
-// Segment represents a transcribed segment
+// samplesDuration returns the duration of n samples at SampleRate
+func samplesDuration(n int) time.Duration {
+	return time.Duration(n) * time.Second / SampleRate
+}
+
+// conversion returns the audio conversion settings of the options
+func (o TranscriptionOptions) conversion() conversion {
+	return conversion{ffmpegArgs: o.FFmpegArgs, format: o.IntermediateFormat, decoder: o.Decoder, cacheDir: o.ConversionCacheDir}
+}
+
+// Segment represents a transcribed segment.
+// Start and End are in nanoseconds and can be converted with time.Duration.
 type Segment struct {
 	Id     int32
 	Text   string
 	Start  int64
 	End    int64
 	Tokens []int32
+	// Speaker is the speaker label, only set when diarizing with NumSpeakers
+	Speaker string
+	// Probability is the mean probability of the segment tokens, a rough confidence score
+	Probability float32
+	// Language is the code of the language detected for the audio the segment was
+	// decoded from, only set when TranscriptionOptions.Language is empty or "auto".
+	// whisper detects the language once per transcribed buffer, so segments of
+	// code-switched audio are only tagged individually when the audio is transcribed
+	// in windows, as done by TranscribeReader and checkpointed transcription.
+	Language string
+	// Words are the words of the segment, only set with WordTimestamps
+	Words []Word
+}
+
+// Word is a word of a segment with its timing.
+// Start and End are in nanoseconds like the segment times.
+type Word struct {
+	Text        string
+	Start       int64
+	End         int64
+	Probability float32 // mean probability of the word tokens
 }
 
 // TranscriptionResult result of transcription
 type TranscriptionResult struct {
 	Segments []*Segment
 	Text     string
+	// Duration is the length of the transcribed audio. It is also set when the
+	// audio is rejected with ErrAudioTooLong.
+	Duration time.Duration
 }
 
 // Transcribe transcribes the audio file
 func (w *Whisper) Transcribe(audioFile string, opts TranscriptionOptions) (TranscriptionResult, error) {
-	// Convert audio to appropriate format (16kHz wav)
-	// We use a temp file for conversion
-	dir, err := os.MkdirTemp("", "whisper")
+	if len(opts.ChannelSpeakerNames) > 0 {
+		return w.transcribeChannels(audioFile, opts)
+	}
+
+	data, err := readAudioFile(audioFile, opts.conversion())
 	if err != nil {
 		return TranscriptionResult{}, err
 	}
-	defer os.RemoveAll(dir)
 
-	convertedPath := filepath.Join(dir, "converted.wav")
+	if opts.Checkpoint != "" {
+		return w.transcribeCheckpointed(data, opts, &checkpoint{AudioFile: audioFile, Samples: len(data)})
+	}
+
+	return w.transcribe(data, opts, nil)
+}
 
-	// Use internal helper to convert audio
-	if err := audioToWav(audioFile, convertedPath); err != nil {
-		return TranscriptionResult{}, fmt.Errorf("failed to convert audio: %w", err)
+// TranscribeBatch transcribes several files with the loaded model. A failing file
+// does not abort the batch: results[i] and errs[i] correspond to files[i].
+// The native library holds a single model context, so files are processed sequentially.
+func (w *Whisper) TranscribeBatch(files []string, opts TranscriptionOptions) ([]TranscriptionResult, []error) {
+	results := make([]TranscriptionResult, len(files))
+	errs := make([]error, len(files))
+	for i, file := range files {
+		results[i], errs[i] = w.Transcribe(file, opts)
 	}
+	return results, errs
+}
 
-	// Open samples
-	fh, err := os.Open(convertedPath)
+// TranscribePreview transcribes only the first seconds of the audio file, for
+// example to show quick feedback while the full transcription runs.
+func (w *Whisper) TranscribePreview(audioFile string, seconds int, opts TranscriptionOptions) (TranscriptionResult, error) {
+	if seconds <= 0 {
+		return TranscriptionResult{}, fmt.Errorf("preview length must be positive, got %d seconds", seconds)
+	}
+
+	// Let ffmpeg stop early so long files are not converted in full
+	conv := opts.conversion()
+	conv.ffmpegArgs = append(slices.Clip(conv.ffmpegArgs), "-t", strconv.Itoa(seconds))
+
+	data, err := readAudioFile(audioFile, conv)
 	if err != nil {
 		return TranscriptionResult{}, err
 	}
-	defer fh.Close()
 
-	// Read samples
-	d := wav.NewDecoder(fh)
-	buf, err := d.FullPCMBuffer()
+	if n := seconds * SampleRate; len(data) > n {
+		data = data[:n]
+	}
+
+	return w.transcribe(data, opts, nil)
+}
+
+// TranscribePreparedWAV transcribes a WAV file that is already 16kHz mono, for
+// example produced by an earlier pipeline stage, without converting it with ffmpeg.
+// It fails if the file has another sample rate or channel count.
+func (w *Whisper) TranscribePreparedWAV(path string, opts TranscriptionOptions) (TranscriptionResult, error) {
+	info, err := Probe(path)
 	if err != nil {
 		return TranscriptionResult{}, err
 	}
+	if info.SampleRate != SampleRate || info.Channels != 1 {
+		return TranscriptionResult{}, fmt.Errorf("%s is not prepared for whisper (sample rate %d, channels %d): expected %dHz mono",
+			path, info.SampleRate, info.Channels, SampleRate)
+	}
 
-	data := buf.AsFloat32Buffer().Data
-	segsLen := uintptr(0xdeadbeef)
-	segsLenPtr := unsafe.Pointer(&segsLen)
+	data, err := decodeWAV(path)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	return w.transcribe(data, opts, nil)
+}
+
+// TranscribeSamples transcribes 16kHz mono float32 samples.
+// It works purely in memory: no temp files and no ffmpeg. With default options
+// nothing is logged on the Go side; EnglishOnly, RemoveDCOffset and Hotwords may
+// log warnings. The native library always prints its progress to stderr.
+func (w *Whisper) TranscribeSamples(samples []float32, opts TranscriptionOptions) (TranscriptionResult, error) {
+	return w.transcribe(samples, opts, nil)
+}
+
+// transcribe runs the native transcription on 16kHz mono samples.
+// If onSegment is non-nil it is called for every segment as soon as the native
+// library decodes it; an error from it aborts the transcription.
+func (w *Whisper) transcribe(data []float32, opts TranscriptionOptions, onSegment func(*Segment) error) (TranscriptionResult, error) {
+	w.lock()
+	defer w.unlock()
 
-	if ret := w.cppTranscribe(opts.Threads, opts.Language, opts.Translate, opts.Diarize, data, uintptr(len(data)), segsLenPtr, opts.Prompt); ret != 0 {
-		return TranscriptionResult{}, fmt.Errorf("failed Transcribe execution")
+	if !w.state.modelLoaded {
+		return TranscriptionResult{}, ErrModelNotLoaded
 	}
 
-	segments := []*Segment{}
-	text := ""
-	for i := range int(segsLen) {
-		// segment start/end conversion factor taken from https://github.com/ggml-org/whisper.cpp/blob/master/examples/cli/cli.cpp#L895
-		s := w.cppGetSegmentStart(i) * (10000000)
-		t := w.cppGetSegmentEnd(i) * (10000000)
+	if err := opts.checkDuration(len(data)); err != nil {
+		return TranscriptionResult{Duration: samplesDuration(len(data))}, err
+	}
 
-		// Copy string to avoid memory issues if C++ frees it (though purego usually copies)
-		txt := w.cppGetSegmentText(i)
-		// txt := strings.Clone(w.cppGetSegmentText(i)) // Clone if needed, but purego string marshaling typically creates a go string copy?
-		// Actually, purego converts *char to string by copying.
+	if opts.Threads == 0 {
+		opts.Threads = defaultThreads()
+	}
 
-		tokens := make([]int32, w.cppNTokens(i))
+	if opts.EnglishOnly {
+		if opts.Language != "" && opts.Language != "en" {
+			log.Printf("whisper: EnglishOnly overrides language %q with \"en\"", opts.Language)
+		}
+		opts.Language = "en"
+		opts.Translate = false
+	}
 
-		if opts.Diarize && w.cppGetSegmentSpeakerTurnNext(i) {
-			txt += " [SPEAKER_TURN]"
+	if opts.Translate && !w.cppIsMultilingual() {
+		return TranscriptionResult{}, ErrTranslationUnsupported
+	}
+
+	if opts.Diarize && w.cppGetSegmentSpeakerTurnNext == nil {
+		return TranscriptionResult{}, ErrDiarizationUnsupported
+	}
+
+	if opts.RemoveDCOffset {
+		if f := clippedFraction(data); f >= clipWarnFraction {
+			log.Printf("whisper: %.2f%% of samples are clipped, transcription quality may suffer", 100*f)
 		}
+		data = removeDCOffset(data)
+	}
+
+	if opts.SilenceGateDB != 0 && rmsDBFS(data) < float64(opts.SilenceGateDB) {
+		return TranscriptionResult{Segments: []*Segment{}, Duration: samplesDuration(len(data))}, nil
+	}
+
+	if opts.NormalizeGain {
+		data = normalizeGain(data)
+	}
 
-		for j := range tokens {
-			tokens[j] = int32(w.cppGetTokenID(i, j))
+	autoLanguage := opts.Language == "" || opts.Language == "auto"
+	if autoLanguage && (opts.MinLanguageProb > 0 || len(opts.CandidateLanguages) > 0) {
+		language, err := w.resolveLanguage(data, opts)
+		if err != nil {
+			return TranscriptionResult{}, err
 		}
-		segment := &Segment{
-			Id:    int32(i),
-			Text:  txt,
-			Start: s, End: t,
-			Tokens: tokens,
+		opts.Language = language
+	}
+
+	segsLen := uintptr(0xdeadbeef)
+	segsLenPtr := unsafe.Pointer(&segsLen)
+
+	prompt := buildPrompt(opts.Prompt, opts.Hotwords)
+
+	var (
+		language string
+		segments = []*Segment{}
+		speaker  int
+		eot      = int32(w.specialTokens().eot)
+		// next is the index of the next native segment to collect
+		next    int
+		stopped bool
+		err     error
+	)
+
+	// collect turns the native segments up to end into Segments and hands them to
+	// the callbacks. It runs from the native library as segments are decoded and
+	// returns false once a callback stops the transcription.
+	collect := func(end int) bool {
+		if autoLanguage {
+			language = w.cppFullLang()
 		}
+		for ; next < end && !stopped; next++ {
+			i := next
+			// segment start/end conversion factor taken from https://github.com/ggml-org/whisper.cpp/blob/master/examples/cli/cli.cpp#L895
+			s := int64(centisecondsToDuration(w.cppGetSegmentStart(i)))
+			t := int64(centisecondsToDuration(w.cppGetSegmentEnd(i)))
+
+			// purego copies the returned C string into a Go string
+			txt, txtErr := sanitizeText(w.cppGetSegmentText(i), opts.InvalidUTF8)
+			if txtErr != nil {
+				err = fmt.Errorf("segment %d: %w", i, txtErr)
+				stopped = true
+				break
+			}
+
+			nTokens := w.cppNTokens(i)
+			tokens := make([]int32, 0, nTokens)
+
+			turnNext := opts.Diarize && w.cppGetSegmentSpeakerTurnNext(i)
+			if turnNext {
+				txt += " [SPEAKER_TURN]"
+			}
+
+			var probSum float32
+			for j := range nTokens {
+				probSum += w.cppGetTokenP(i, j)
+				id := int32(w.cppGetTokenID(i, j))
+				if opts.ExcludeSpecialTokens && id >= eot {
+					continue
+				}
+				tokens = append(tokens, id)
+			}
+			segment := &Segment{
+				Id:    int32(i),
+				Text:  txt,
+				Start: s, End: t,
+				Tokens:   tokens,
+				Language: language,
+			}
+			if nTokens > 0 {
+				segment.Probability = probSum / float32(nTokens)
+			}
+			if opts.WordTimestamps {
+				segment.Words = w.segmentWords(i, nTokens, eot)
+			}
+
+			if opts.Diarize && opts.NumSpeakers > 0 {
+				segment.Speaker = speakerLabel(speaker)
+				if turnNext {
+					speaker = (speaker + 1) % opts.NumSpeakers
+				}
+			}
+
+			if opts.TransformSegment != nil {
+				opts.TransformSegment(segment)
+			}
 
-		segments = append(segments, segment)
+			if onSegment != nil {
+				if err = onSegment(segment); err != nil {
+					stopped = true
+					break
+				}
+			}
 
-		text += " " + strings.TrimSpace(txt)
+			segments = append(segments, segment)
+
+			if opts.OnSegment != nil && !opts.OnSegment(segment) {
+				stopped = true
+			}
+		}
+		return !stopped
+	}
+
+	id, unregister := registerSegmentHandler(func(first, n int) bool { return collect(first + n) })
+	defer unregister()
+
+	if ret := w.cppTranscribe(opts.Threads, opts.Language, opts.Translate, opts.Diarize, data, uintptr(len(data)), segsLenPtr, prompt, opts.NoTimestamps, opts.WordTimestamps, opts.Processors, segmentCallback(), id); ret != 0 {
+		return TranscriptionResult{}, &NativeError{Op: "transcribe", Code: ret}
+	}
+
+	// whisper_full_parallel does not report segments while decoding
+	collect(int(segsLen))
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+
+	if opts.MaxCompressionRatio > 0 {
+		segments = filterCompressionRatio(segments, opts.MaxCompressionRatio)
+	}
+
+	if opts.DeduplicateSegments {
+		segments = deduplicateSegments(segments)
 	}
 
 	return TranscriptionResult{
 		Segments: segments,
-		Text:     strings.TrimSpace(text),
+		Text:     segmentsText(segments, textJoiner(opts.TextJoiner, opts.Language, segments)),
+		Duration: samplesDuration(len(data)),
 	}, nil
 }
 
-// audioToWav converts input audio to 16kHz WAV using ffmpeg
-func audioToWav(src, dst string) error {
-	cmd := exec.Command("ffmpeg", "-y", "-i", src, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", dst)
+// segmentWords groups the text tokens of segment i into words. A token starting
+// with a space starts a new word, and so does every character of scripts written
+// without spaces.
+func (w *Whisper) segmentWords(i, nTokens int, eot int32) []Word {
+	words := []Word{}
+	var tokens int
+	for j := range nTokens {
+		if int32(w.cppGetTokenID(i, j)) >= eot {
+			continue
+		}
+		txt := w.cppGetTokenText(i, j)
+		start := int64(centisecondsToDuration(w.cppGetTokenStart(i, j)))
+		end := int64(centisecondsToDuration(w.cppGetTokenEnd(i, j)))
+		p := w.cppGetTokenP(i, j)
+
+		first, _ := utf8.DecodeRuneInString(txt)
+		if len(words) == 0 || unicode.IsSpace(first) || unicode.In(first, unspacedScripts...) {
+			words = append(words, Word{Text: txt, Start: start, End: end, Probability: p})
+			tokens = 1
+			continue
+		}
+		word := &words[len(words)-1]
+		word.Text += txt
+		word.End = max(word.End, end)
+		word.Probability = (word.Probability*float32(tokens) + p) / float32(tokens+1)
+		tokens++
+	}
+	for k := range words {
+		words[k].Text = strings.TrimSpace(words[k].Text)
+	}
+	return words
+}
+
+// segmentsText joins the text of the segments with the given separator
+func segmentsText(segments []*Segment, joiner string) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if txt := strings.TrimSpace(segment.Text); txt != "" {
+			parts = append(parts, txt)
+		}
+	}
+	return strings.Join(parts, joiner)
+}
+
+// textJoiner returns the separator used to join segment text. An explicit joiner
+// wins, otherwise languages written without spaces between words (Chinese,
+// Japanese, Thai, ...) are joined directly and everything else with a space.
+func textJoiner(joiner, language string, segments []*Segment) string {
+	if joiner != "" {
+		return joiner
+	}
+	if language != "" && language != "auto" {
+		if slices.Contains(unspacedLanguages, language) {
+			return ""
+		}
+		return " "
+	}
+	// Auto-detected language: look at the script of the text
+	var unspaced, letters int
+	for _, segment := range segments {
+		for _, r := range segment.Text {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+			if unicode.In(r, unspacedScripts...) {
+				unspaced++
+			}
+		}
+	}
+	if letters > 0 && unspaced*2 > letters {
+		return ""
+	}
+	return " "
+}
+
+// unspacedLanguages are written without spaces between words
+var unspacedLanguages = []string{"zh", "ja", "yue", "th", "lo", "my", "km", "bo"}
+
+// unspacedScripts are the scripts of unspacedLanguages
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Myanmar, unicode.Khmer, unicode.Tibetan,
+}
+
+// maxPromptTokens is the prompt budget of whisper (n_text_ctx / 2); older tokens are dropped
+const maxPromptTokens = 224
+
+// buildPrompt combines the initial prompt with the hotwords
+func buildPrompt(prompt string, hotwords []string) string {
+	if len(hotwords) == 0 {
+		return prompt
+	}
+
+	prompt = strings.TrimSpace(prompt + " " + strings.Join(hotwords, ", "))
+
+	// Rough estimate of ~4 characters per token, we have no tokenizer on the Go side
+	if tokens := (len(prompt) + 3) / 4; tokens > maxPromptTokens {
+		log.Printf("whisper: prompt with hotwords is about %d tokens, whisper keeps only the last %d so leading terms will be truncated", tokens, maxPromptTokens)
+	}
+	return prompt
+}
+
+// speakerLabel returns the label for the n-th speaker
+func speakerLabel(n int) string {
+	return fmt.Sprintf("SPEAKER_%02d", n)
+}
+
+// whisper.cpp reports both segment and VAD timestamps in centiseconds (10ms units)
+const centisecondsPerSecond = 100
+
+// centisecondsToDuration converts a native timestamp to a time.Duration
+func centisecondsToDuration(cs int64) time.Duration {
+	return time.Duration(cs) * (time.Second / centisecondsPerSecond)
+}
+
+// secondsToDuration converts fractional seconds to a time.Duration
+func secondsToDuration(sec float32) time.Duration {
+	return time.Duration(math.Round(float64(sec) * float64(time.Second)))
+}
+
+// sanitizeText applies the given InvalidUTF8Policy to segment text
+func sanitizeText(txt string, policy InvalidUTF8Policy) (string, error) {
+	if utf8.ValidString(txt) {
+		return txt, nil
+	}
+	switch policy {
+	case UTF8Strict:
+		return "", ErrInvalidUTF8
+	case UTF8Passthrough:
+		return txt, nil
+	default:
+		return strings.ToValidUTF8(txt, string(utf8.RuneError)), nil
+	}
+}
+
+// readAudioFile converts the audio file to 16kHz mono and returns its samples
+func readAudioFile(audioFile string, conv conversion) ([]float32, error) {
+	if conv.decoder != nil {
+		return decodeCustom(conv.decoder, audioFile)
+	}
+
+	if conv.cacheDir != "" {
+		return readCachedConversion(audioFile, conv)
+	}
+
+	// Convert audio to appropriate format (16kHz wav)
+	// We use a temp file for conversion
+	dir, err := os.MkdirTemp("", tempDirPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	convertedPath := filepath.Join(dir, "converted"+conv.format.ext())
+	if err := convertIntermediate(audioFile, convertedPath, conv); err != nil {
+		return nil, err
+	}
+	return decodeIntermediate(convertedPath, conv.format)
+}
+
+// convertIntermediate converts the audio file to the intermediate format at dst
+func convertIntermediate(audioFile, dst string, conv conversion) error {
+	var err error
+	if conv.format == IntermediateFLAC {
+		err = convertAudio(audioFile, dst, "flac", 1, conv.ffmpegArgs)
+	} else {
+		err = audioToWav(audioFile, dst, conv.ffmpegArgs)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert audio: %w", err)
+	}
+	return nil
+}
+
+// decodeIntermediate reads the samples of a file written by convertIntermediate
+func decodeIntermediate(path string, format IntermediateFormat) ([]float32, error) {
+	if format == IntermediateFLAC {
+		return decodePCM(path)
+	}
+	return decodeWAV(path)
+}
+
+const (
+	// wavFormatPCM is the WAVE_FORMAT_PCM format tag of plain integer PCM
+	wavFormatPCM = 1
+	// wavFormatExtensible is the WAVE_FORMAT_EXTENSIBLE format tag, which the go-audio
+	// decoder mishandles
+	wavFormatExtensible = 0xFFFE
+)
+
+// errUnsupportedWAV is returned by decodeWAVNative for files go-audio cannot decode
+var errUnsupportedWAV = errors.New("unsupported WAV file")
+
+// decodeWAV reads the samples of a 16kHz mono WAV file. Files the pure-Go decoder
+// cannot handle, such as WAVE_FORMAT_EXTENSIBLE headers, are decoded with ffmpeg.
+func decodeWAV(path string) ([]float32, error) {
+	data, err := decodeWAVNative(path)
+	if !errors.Is(err, errUnsupportedWAV) {
+		return data, err
+	}
+
+	data, ffmpegErr := decodePCM(path)
+	if ffmpegErr != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w (ffmpeg fallback: %v)", path, err, ffmpegErr)
+	}
+	return data, nil
+}
+
+// decodeWAVNative reads the samples of a 16kHz mono WAV file with go-audio
+func decodeWAVNative(path string) ([]float32, error) {
+	// Open samples
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	// Read samples
+	d := wav.NewDecoder(fh)
+	d.ReadInfo()
+	if d.WavAudioFormat == wavFormatExtensible {
+		return nil, fmt.Errorf("%w: WAVE_FORMAT_EXTENSIBLE header", errUnsupportedWAV)
+	}
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnsupportedWAV, err)
+	}
+
+	// whisper silently produces garbage on anything but 16kHz mono input
+	if buf.Format == nil || buf.Format.SampleRate != SampleRate || buf.Format.NumChannels != 1 {
+		return nil, fmt.Errorf("converted audio has unexpected format (sample rate %d, channels %d): expected %dHz mono",
+			d.SampleRate, d.NumChans, SampleRate)
+	}
+
+	return buf.AsFloat32Buffer().Data, nil
+}
+
+// SampleRate is the sample rate whisper expects for its input samples
+const SampleRate = 16000
+
+// reservedFFmpegFlags are set by audioToWav and must not be overridden by extra arguments
+var reservedFFmpegFlags = []string{"-ar", "-ac", "-c", "-codec", "-acodec", "-f", "-i", "-y"}
+
+// validateFFmpegArgs rejects extra arguments that would override the mandatory conversion flags
+func validateFFmpegArgs(args []string) error {
+	for _, arg := range args {
+		for _, flag := range reservedFFmpegFlags {
+			// Also match stream specifiers such as -ar:a or -c:a
+			if arg == flag || strings.HasPrefix(arg, flag+":") {
+				return fmt.Errorf("ffmpeg argument %s is not allowed: whisper requires 16kHz mono pcm_s16le input", arg)
+			}
+		}
+	}
+	return nil
+}
+
+// audioToWav converts input audio to 16kHz WAV using ffmpeg.
+// extraArgs are inserted after the input and before the mandatory output flags.
+func audioToWav(src, dst string, extraArgs []string) error {
+	return convertAudio(src, dst, "pcm_s16le", 1, extraArgs)
+}
+
+// convertAudio converts input audio to 16kHz with the given codec and number of
+// channels using ffmpeg. A channel count of 0 keeps the source channel layout.
+func convertAudio(src, dst, codec string, channels int, extraArgs []string) error {
+	if err := validateFFmpegArgs(extraArgs); err != nil {
+		return err
+	}
+
+	args := []string{"-y", "-i", src}
+	args = append(args, extraArgs...)
+	args = append(args, "-ar", strconv.Itoa(SampleRate))
+	if channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(channels))
+	}
+	args = append(args, "-c:a", codec, dst)
+	cmd := exec.Command("ffmpeg", args...)
 	// Check if ffmpeg is seemingly available or just run it.
 	// If user doesn't have ffmpeg, this will fail.
 	// We could check error output.
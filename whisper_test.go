@@ -1,18 +1,21 @@
 package whisper
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func skipIfNoLibrary(t *testing.T) {
 	t.Helper()
-	libName := LibraryName(runtime.GOOS)
-	libFile := filepath.Join(".", libName)
-	if _, err := os.Stat(libFile); os.IsNotExist(err) {
-		t.Skipf("Skipping test: library not found at %s. Download from https://github.com/kawai-network/whisper/releases/latest", libFile)
+	if findBestLibrary(".") == "" {
+		libFile := filepath.Join(".", LibraryName(runtime.GOOS))
+		t.Skipf("Skipping test: library not found at %s. Build it from native/ with make, e.g. make libgowhisper-fallback.so", libFile)
 	}
 }
 
@@ -58,6 +61,39 @@ func TestModelLoading(t *testing.T) {
 	if err := w.Load(modelPath); err != nil {
 		t.Fatalf("Failed to load model: %v", err)
 	}
+
+	info, err := w.ModelInfo()
+	if err != nil {
+		t.Fatalf("Failed to get model info: %v", err)
+	}
+	if info.Type != "tiny" || info.Multilingual || info.Mels != 80 {
+		t.Errorf("Unexpected model info for tiny.en: %+v", info)
+	}
+
+	// Special token ids of the English-only vocabulary
+	if w.TokenEOT() != 50256 || w.TokenBOS() != 50257 || w.TokenTranslate() != 50357 ||
+		w.TokenTranscribe() != 50358 || w.TokenTimestampBegin() != 50363 {
+		t.Errorf("Unexpected special tokens: eot %d, bos %d, translate %d, transcribe %d, timestamp begin %d",
+			w.TokenEOT(), w.TokenBOS(), w.TokenTranslate(), w.TokenTranscribe(), w.TokenTimestampBegin())
+	}
+}
+
+func TestModelLoadingTurbo(t *testing.T) {
+	modelPath := "test/data/ggml-large-v3-turbo.bin"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load turbo model: %v", err)
+	}
+	if !w.IsMultilingual() {
+		t.Error("Expected large-v3-turbo to be multilingual")
+	}
 }
 
 func TestTranscribeBasic(t *testing.T) {
@@ -242,3 +278,517 @@ func TestInvalidAudioPath(t *testing.T) {
 		t.Error("Expected error when transcribing non-existent audio, got nil")
 	}
 }
+
+func TestSanitizeText(t *testing.T) {
+	invalid := "caf\xe9 au lait"
+
+	txt, err := sanitizeText(invalid, UTF8Replace)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if txt != "caf� au lait" {
+		t.Errorf("Expected replacement rune, got %q", txt)
+	}
+
+	if _, err := sanitizeText(invalid, UTF8Strict); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("Expected ErrInvalidUTF8, got %v", err)
+	}
+
+	if txt, _ := sanitizeText(invalid, UTF8Passthrough); txt != invalid {
+		t.Errorf("Expected text to be passed through, got %q", txt)
+	}
+
+	if txt, _ := sanitizeText("hello", UTF8Strict); txt != "hello" {
+		t.Errorf("Expected valid text to be unchanged, got %q", txt)
+	}
+}
+
+func TestTimeConversion(t *testing.T) {
+	if d := centisecondsToDuration(240); d != 2400*time.Millisecond {
+		t.Errorf("Expected 2.4s, got %v", d)
+	}
+
+	seg := VADSegment{Start: 1.5, End: 2.25}
+	if d := seg.StartDuration(); d != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s, got %v", d)
+	}
+	if d := seg.EndDuration(); d != 2250*time.Millisecond {
+		t.Errorf("Expected 2.25s, got %v", d)
+	}
+}
+
+func TestValidateFFmpegArgs(t *testing.T) {
+	if err := validateFFmpegArgs([]string{"-af", "highpass=f=200,loudnorm"}); err != nil {
+		t.Errorf("Expected filter arguments to be allowed, got %v", err)
+	}
+
+	for _, args := range [][]string{{"-ar", "8000"}, {"-ac", "2"}, {"-c:a", "flac"}} {
+		if err := validateFFmpegArgs(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func BenchmarkTranscribeSamples(b *testing.B) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	if findBestLibrary(".") == "" {
+		b.Skipf("Skipping benchmark: library not found at %s", filepath.Join(".", LibraryName(runtime.GOOS)))
+	}
+	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
+		b.Skipf("Skipping benchmark: model file not found at %s", modelPath)
+	}
+
+	w, err := New(".")
+	if err != nil {
+		b.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	if err := w.Load(modelPath); err != nil {
+		b.Fatalf("Failed to load model: %v", err)
+	}
+
+	// 5 seconds of a 440Hz tone
+	samples := make([]float32, 5*SampleRate)
+	for i := range samples {
+		samples[i] = 0.1 * float32(math.Sin(2*math.Pi*440*float64(i)/SampleRate))
+	}
+
+	opts := TranscriptionOptions{
+		Language: "en",
+		Threads:  1,
+	}
+
+	for b.Loop() {
+		if _, err := w.TranscribeSamples(samples, opts); err != nil {
+			b.Fatalf("Failed to transcribe: %v", err)
+		}
+	}
+}
+
+func TestScanLibraries(t *testing.T) {
+	dir := t.TempDir()
+	prefix, ext := libraryAffixes(runtime.GOOS)
+	for _, name := range []string{prefix + "gowhisper-avx2" + ext, prefix + "gowhisper-fallback-arm64" + ext, "README.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assets := ScanLibraries(dir)
+	if len(assets) != 2 {
+		t.Fatalf("Expected 2 libraries, got %d", len(assets))
+	}
+	if assets[0].Variant != "avx2" || assets[1].Variant != "fallback" {
+		t.Errorf("Unexpected variants: %q, %q", assets[0].Variant, assets[1].Variant)
+	}
+}
+
+func TestVariantSelectors(t *testing.T) {
+	otherArch := "arm64"
+	if runtime.GOARCH == "arm64" {
+		otherArch = "amd64"
+	}
+	prefix, ext := libraryAffixes(runtime.GOOS)
+	assets := []LibraryAsset{
+		{Name: prefix + "gowhisper-avx2" + ext, Variant: "avx2", Size: 300},
+		{Name: prefix + "gowhisper-fallback" + ext, Variant: "fallback", Size: 200},
+		{Name: prefix + "gowhisper-fallback-" + runtime.GOARCH + ext, Variant: "fallback", Size: 250},
+		{Name: prefix + "gowhisper-fallback-" + otherArch + ext, Variant: "fallback", Size: 100},
+	}
+
+	if asset := SelectFallback(assets); asset == nil || asset.Name != prefix+"gowhisper-fallback-"+runtime.GOARCH+ext {
+		t.Errorf("Expected arch-qualified fallback, got %+v", asset)
+	}
+	if asset := SelectSmallest(assets); asset == nil || asset.Size != 200 {
+		t.Errorf("Expected smallest library for this architecture, got %+v", asset)
+	}
+	if asset := SelectFastestSupported(assets); asset == nil {
+		t.Error("Expected a supported library")
+	}
+	if asset := SelectFallback(assets[:1]); asset != nil {
+		t.Errorf("Expected no fallback, got %+v", asset)
+	}
+
+	// A toolchain suffix is not an architecture
+	msvc := []LibraryAsset{{Name: prefix + "gowhisper-fallback-msvc" + ext, Variant: "fallback", Size: 200}}
+	if asset := SelectFallback(msvc); asset == nil {
+		t.Error("Expected the msvc build to be selectable")
+	}
+	if arch := detectArch(prefix + "gowhisper-fallback-msvc-" + otherArch + ext); arch != otherArch {
+		t.Errorf("Expected arch %s, got %q", otherArch, arch)
+	}
+
+	if _, err := NewWithSelector(t.TempDir(), SelectFallback); err == nil {
+		t.Error("Expected error when no library matches the selector")
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	if p := buildPrompt("Support call.", nil); p != "Support call." {
+		t.Errorf("Expected prompt unchanged, got %q", p)
+	}
+	if p := buildPrompt("Support call.", []string{"Kawai", "GoWhisper"}); p != "Support call. Kawai, GoWhisper" {
+		t.Errorf("Unexpected prompt %q", p)
+	}
+	if p := buildPrompt("", []string{"Kawai"}); p != "Kawai" {
+		t.Errorf("Unexpected prompt %q", p)
+	}
+}
+
+func TestNativeError(t *testing.T) {
+	err := fmt.Errorf("failed to load model: %w", &NativeError{Op: "load_model", Code: 1})
+
+	var nerr *NativeError
+	if !errors.As(err, &nerr) {
+		t.Fatal("Expected errors.As to find NativeError")
+	}
+	if nerr.Op != "load_model" || nerr.Code != 1 {
+		t.Errorf("Unexpected NativeError %+v", nerr)
+	}
+}
+
+func TestCheckLibraryFormat(t *testing.T) {
+	dir := t.TempDir()
+	elf := filepath.Join(dir, "libgowhisper-fallback.so")
+	if err := os.WriteFile(elf, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	html := filepath.Join(dir, "gowhisper-fallback.dll")
+	if err := os.WriteFile(html, []byte("<html>Not Found</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkLibraryFormat(elf, "linux"); err != nil {
+		t.Errorf("Expected ELF library to be accepted on linux, got %v", err)
+	}
+	if err := checkLibraryFormat(elf, "darwin"); err == nil {
+		t.Error("Expected ELF library to be rejected on darwin")
+	}
+	if err := checkLibraryFormat(html, "windows"); err == nil {
+		t.Error("Expected non-library file to be rejected")
+	}
+
+	empty := filepath.Join(dir, "libgowhisper-empty.so")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLibraryFormat(empty, "linux"); err == nil {
+		t.Error("Expected empty library to be rejected")
+	}
+}
+
+func TestTextJoiner(t *testing.T) {
+	japanese := []*Segment{{Text: "こんにちは"}, {Text: "世界"}}
+	english := []*Segment{{Text: " Hello"}, {Text: " world"}}
+
+	if text := segmentsText(japanese, textJoiner("", "", japanese)); text != "こんにちは世界" {
+		t.Errorf("Expected Japanese segments to be joined directly, got %q", text)
+	}
+	if text := segmentsText(english, textJoiner("", "auto", english)); text != "Hello world" {
+		t.Errorf("Expected English segments to be joined with a space, got %q", text)
+	}
+	if j := textJoiner("", "zh", english); j != "" {
+		t.Errorf("Expected no separator for zh, got %q", j)
+	}
+	if j := textJoiner("\n", "ja", japanese); j != "\n" {
+		t.Errorf("Expected explicit joiner to win, got %q", j)
+	}
+}
+
+func TestTranscribeWithoutModel(t *testing.T) {
+	skipIfNoLibrary(t)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+
+	if _, err := w.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded, got %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	if err := w.SelfTest(); err != nil {
+		t.Errorf("Self-test failed: %v", err)
+	}
+}
+
+func TestFailedReload(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+	if err := w.Load("test/data/does-not-exist.bin"); err == nil {
+		t.Fatal("Expected loading a missing model to fail")
+	}
+
+	// The native loader dropped the previous model, nothing may reach it
+	if _, err := w.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded after a failed reload, got %v", err)
+	}
+	if _, err := w.ModelInfo(); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ModelInfo to return ErrModelNotLoaded, got %v", err)
+	}
+	if w.TokenEOT() != -1 || w.VocabSize() != 0 || w.IsMultilingual() {
+		t.Error("Expected model accessors to report no model after a failed reload")
+	}
+}
+
+func TestSharedModel(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+
+	a, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	b, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer b.Close()
+
+	if err := a.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+	if err := b.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Failed to close instance: %v", err)
+	}
+
+	// Closing a must not free the model b still uses
+	if _, err := b.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); err != nil {
+		t.Fatalf("Failed to transcribe after another instance closed: %v", err)
+	}
+	if _, err := a.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded from the closed instance, got %v", err)
+	}
+}
+
+func TestLeakedInstance(t *testing.T) {
+	modelPath := "test/data/ggml-tiny.en.bin"
+	skipIfNoLibrary(t)
+	skipIfNoModel(t, modelPath)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer w.Close()
+	if err := w.Load(modelPath); err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	// The finalizer of a leaked instance must not free the shared model
+	if _, err := New("."); err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	runtime.GC()
+	runtime.GC()
+
+	if _, err := w.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); err != nil {
+		t.Fatalf("Failed to transcribe after a leaked instance was collected: %v", err)
+	}
+}
+
+func TestVADSegmentSampleRange(t *testing.T) {
+	start, end := VADSegment{Start: 0.5, End: 1.25}.SampleRange(SampleRate, 2*SampleRate)
+	if start != 8000 || end != 20000 {
+		t.Errorf("Expected [8000, 20000), got [%d, %d)", start, end)
+	}
+
+	start, end = VADSegment{Start: -0.1, End: -0.2}.SampleRange(SampleRate, 2*SampleRate)
+	if start != 0 || end != 0 {
+		t.Errorf("Expected clamped [0, 0), got [%d, %d)", start, end)
+	}
+
+	// VAD may report times past the end of the audio
+	start, end = VADSegment{Start: 1.5, End: 2.5}.SampleRange(SampleRate, 2*SampleRate)
+	if start != 24000 || end != 32000 {
+		t.Errorf("Expected [24000, 32000), got [%d, %d)", start, end)
+	}
+	start, end = VADSegment{Start: 3, End: 4}.SampleRange(SampleRate, 2*SampleRate)
+	if start != 32000 || end != 32000 {
+		t.Errorf("Expected clamped [32000, 32000), got [%d, %d)", start, end)
+	}
+}
+
+func TestReloadLibrary(t *testing.T) {
+	skipIfNoLibrary(t)
+
+	w, err := New(".")
+	if err != nil {
+		t.Fatalf("Failed to initialize whisper: %v", err)
+	}
+	defer w.Close()
+
+	bogus := filepath.Join(t.TempDir(), LibraryName(runtime.GOOS))
+	if err := os.WriteFile(bogus, []byte("<html>Not Found</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadLibrary(bogus); err == nil {
+		t.Fatal("Expected reloading a non-library file to fail")
+	}
+
+	// Opening the loaded path again returns the loaded library, not new code
+	if err := w.ReloadLibrary(findBestLibrary(".")); err == nil {
+		t.Fatal("Expected reloading the loaded path to fail")
+	}
+
+	data, err := os.ReadFile(findBestLibrary("."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded := filepath.Join(t.TempDir(), LibraryName(runtime.GOOS))
+	if err := os.WriteFile(upgraded, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadLibrary(upgraded); err != nil {
+		t.Fatalf("Failed to reload library: %v", err)
+	}
+	if _, err := w.TranscribeSamples(make([]float32, SampleRate), TranscriptionOptions{}); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Expected ErrModelNotLoaded after reload, got %v", err)
+	}
+}
+
+func TestGlibcVersion(t *testing.T) {
+	if compareVersions("2.35", "2.4") <= 0 || compareVersions("2.31", "2.31") != 0 || compareVersions("2.3", "2.3.4") >= 0 {
+		t.Error("Unexpected version ordering")
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping glibc check on non-Linux platform")
+	}
+	system, err := systemGlibcVersion()
+	if err != nil {
+		t.Skipf("Skipping test: no glibc: %v", err)
+	}
+	required, err := requiredGlibcVersion("/bin/sh")
+	if err != nil || required == "" {
+		t.Skipf("Skipping test: /bin/sh is not dynamically linked against glibc")
+	}
+	if compareVersions(required, system) > 0 {
+		t.Errorf("/bin/sh requires glibc %s but system has %s", required, system)
+	}
+	if err := checkGlibcVersion("/bin/sh"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckDuration(t *testing.T) {
+	opts := TranscriptionOptions{MaxDurationSec: 10}
+	if err := opts.checkDuration(10 * SampleRate); err != nil {
+		t.Errorf("Expected audio at the limit to be accepted, got %v", err)
+	}
+	if err := opts.checkDuration(10*SampleRate + 1); !errors.Is(err, ErrAudioTooLong) {
+		t.Errorf("Expected ErrAudioTooLong, got %v", err)
+	}
+	if err := (TranscriptionOptions{}).checkDuration(1 << 30); err != nil {
+		t.Errorf("Expected no limit by default, got %v", err)
+	}
+	if d := samplesDuration(SampleRate / 2); d != 500*time.Millisecond {
+		t.Errorf("Expected 500ms, got %v", d)
+	}
+}
+
+func TestExtractLibrary(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+
+	data := []byte("\x7fELF not really a library")
+	path, err := extractLibrary(data, "libgowhisper.so")
+	if err != nil {
+		t.Fatalf("Failed to extract: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(data) {
+		t.Errorf("Extracted library has unexpected content %q", got)
+	}
+
+	info, _ := os.Stat(path)
+	again, err := extractLibrary(data, "libgowhisper.so")
+	if err != nil || again != path {
+		t.Fatalf("Expected the cached library to be reused, got %s, %v", again, err)
+	}
+	if info2, _ := os.Stat(again); !info2.ModTime().Equal(info.ModTime()) {
+		t.Error("Expected the cached library not to be rewritten")
+	}
+
+	other, err := extractLibrary([]byte("\x7fELF another build"), "libgowhisper.so")
+	if err != nil || other == path {
+		t.Errorf("Expected a different library to get its own path, got %s, %v", other, err)
+	}
+}
+
+func TestCandidateScores(t *testing.T) {
+	scores := []LanguageScore{{"de", 0.5}, {"en", 0.3}, {"es", 0.1}, {"fr", 0.1}}
+	got, err := candidateScores(scores, []string{"fr", "en"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Code != "en" || got[1].Code != "fr" {
+		t.Fatalf("Expected en then fr, got %v", got)
+	}
+	if math.Abs(float64(got[0].Prob)-0.75) > 1e-6 || math.Abs(float64(got[1].Prob)-0.25) > 1e-6 {
+		t.Errorf("Expected probabilities renormalized to 0.75 and 0.25, got %v", got)
+	}
+
+	if _, err := candidateScores(scores, []string{"xx"}); err == nil {
+		t.Error("Expected error for unknown candidate language")
+	}
+}
+
+func TestDefaultThreads(t *testing.T) {
+	for _, tt := range []struct {
+		cpuMax string
+		want   int
+	}{
+		{"max 100000\n", 0},
+		{"200000 100000\n", 2},
+		{"150000 100000\n", 2},
+		{"50000 100000\n", 1},
+		{"garbage", 0},
+	} {
+		if got := parseCPUMax(tt.cpuMax); got != tt.want {
+			t.Errorf("parseCPUMax(%q) = %d, want %d", tt.cpuMax, got, tt.want)
+		}
+	}
+	if got := parseCFSQuota("-1\n", "100000\n"); got != 0 {
+		t.Errorf("Expected unlimited v1 quota to return 0, got %d", got)
+	}
+
+	t.Setenv(threadsEnv, "3")
+	if got := defaultThreads(); got != 3 {
+		t.Errorf("Expected %s to set the default threads, got %d", threadsEnv, got)
+	}
+	t.Setenv(threadsEnv, "zero")
+	if got := defaultThreads(); got == 0 || got > uint32(runtime.NumCPU()) {
+		t.Errorf("Expected an invalid %s to be ignored, got %d", threadsEnv, got)
+	}
+}
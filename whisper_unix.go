@@ -12,12 +12,34 @@ func loadLibrary(path string) (uintptr, error) {
 	return purego.Dlopen(path, purego.RTLD_NOW|purego.RTLD_GLOBAL)
 }
 
-// registerLibFunc is a wrapper around purego.RegisterLibFunc for Unix
-func registerLibFunc(fn interface{}, lib uintptr, name string) {
-	purego.RegisterLibFunc(fn, lib, name)
+// registerLibFunc is a wrapper around purego.RegisterFunc for Unix.
+// It looks the symbol up first, purego.RegisterLibFunc panics when it is missing.
+func registerLibFunc(fn interface{}, lib uintptr, name string) error {
+	sym, err := purego.Dlsym(lib, name)
+	if err != nil {
+		return err
+	}
+	purego.RegisterFunc(fn, sym)
+	return nil
 }
 
 // closeLibrary unloads the shared library on Unix systems
 func closeLibrary(handle uintptr) error {
 	return purego.Dlclose(handle)
 }
+
+// systemGlibcVersion returns the version of the glibc the process runs with,
+// failing on systems with another libc
+func systemGlibcVersion() (string, error) {
+	lib, err := purego.Dlopen("libc.so.6", purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		return "", err
+	}
+	defer purego.Dlclose(lib)
+
+	var gnuGetLibcVersion func() string
+	if err := registerLibFunc(&gnuGetLibcVersion, lib, "gnu_get_libc_version"); err != nil {
+		return "", err
+	}
+	return gnuGetLibcVersion(), nil
+}
@@ -4,6 +4,7 @@
 package whisper
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 
@@ -21,15 +22,16 @@ func loadLibrary(path string) (uintptr, error) {
 }
 
 // registerLibFunc is a wrapper around purego.RegisterLibFunc that works with Windows handles
-func registerLibFunc(fn interface{}, lib uintptr, name string) {
+func registerLibFunc(fn interface{}, lib uintptr, name string) error {
 	// On Windows, we need to get the procedure address first
 	handle := windows.Handle(lib)
 	proc, err := windows.GetProcAddress(handle, name)
 	if err != nil {
-		return
+		return err
 	}
 	// Use purego.RegisterFunc for Windows
 	purego.RegisterFunc(fn, proc)
+	return nil
 }
 
 // closeLibrary unloads the DLL on Windows
@@ -37,6 +39,11 @@ func closeLibrary(handle uintptr) error {
 	return windows.FreeLibrary(windows.Handle(handle))
 }
 
+// systemGlibcVersion always fails on Windows, which has no glibc
+func systemGlibcVersion() (string, error) {
+	return "", errors.New("glibc is not available on windows")
+}
+
 // init registers the Go runtime for purego
 func init() {
 	// Ensure we're on Windows